@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"github.com/hajimehoshi/ebiten/v2"
+	log "github.com/sirupsen/logrus"
+	"image"
+	"image/color"
+	_ "image/png"
+	"sort"
+	"time"
+)
+
+//go:embed assets/*.png
+var assetFS embed.FS
+
+// rows and columns of the sprite sheets in assets
+const (
+	// player.png, a row per walking direction, the last row is dying
+	playerRowDown  = 0
+	playerRowLeft  = 1
+	playerRowRight = 2
+	playerRowUp    = 3
+	playerRowDeath = 4
+
+	// flame.png, two rows flicker
+	flameColCenter     = 0
+	flameColHorizontal = 1
+	flameColVertical   = 2
+	flameColTipLeft    = 3
+	flameColTipRight   = 4
+	flameColTipUp      = 5
+	flameColTipDown    = 6
+
+	// block.png, the crumbling frames follow the block
+	blockColWall    = 0
+	blockColBlock   = 1
+	blockColCrumble = 2
+	crumbleFrames   = 4
+)
+
+const (
+	crumbleDuration  = 400 * time.Millisecond
+	walkDuration     = 200 * time.Millisecond
+	deathDuration    = 600 * time.Millisecond
+	bombPulsePeriod  = 400 * time.Millisecond
+	flameFlickerTime = 100 * time.Millisecond
+)
+
+// skins tint the player sprite, they are selected by playerInfo.avatar
+var skins = map[string]color.Color{
+	"fff": color.White,
+	"f44": color.RGBA{R: 0xff, G: 0x44, B: 0x44, A: 0xff},
+	"4f4": color.RGBA{R: 0x44, G: 0xff, B: 0x44, A: 0xff},
+	"44f": color.RGBA{R: 0x66, G: 0x66, B: 0xff, A: 0xff},
+	"ff4": color.RGBA{R: 0xff, G: 0xff, B: 0x44, A: 0xff},
+	"f4f": color.RGBA{R: 0xff, G: 0x44, B: 0xff, A: 0xff},
+	"4ff": color.RGBA{R: 0x44, G: 0xff, B: 0xff, A: 0xff},
+}
+
+const defaultAvatar = "fff"
+
+// validAvatar replace unknown avatars received from other clients with the default one
+func validAvatar(avatar string) string {
+	if _, ok := skins[avatar]; !ok {
+		log.Warningf("unknown avatar %q, use %q", avatar, defaultAvatar)
+		return defaultAvatar
+	}
+	return avatar
+}
+
+// avatarNames list the valid avatars in order
+func avatarNames() []string {
+	names := make([]string, 0, len(skins))
+	for name := range skins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// spriteSheet is an image of gridSize x gridSize frames
+type spriteSheet struct {
+	image *ebiten.Image
+}
+
+func loadSpriteSheet(name string) *spriteSheet {
+	data, err := assetFS.ReadFile("assets/" + name)
+	if err != nil {
+		log.Fatal("[loadSpriteSheet]", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Fatal("[loadSpriteSheet]", name, err)
+	}
+	return &spriteSheet{image: ebiten.NewImageFromImage(img)}
+}
+
+func (s *spriteSheet) frame(col, row int) *ebiten.Image {
+	rect := image.Rect(col*gridSize, row*gridSize, (col+1)*gridSize, (row+1)*gridSize)
+	return s.image.SubImage(rect).(*ebiten.Image)
+}
+
+// animation plays frames of a sheet row from the first column
+type animation struct {
+	sheet    *spriteSheet
+	row      int
+	frames   int
+	duration time.Duration
+	// loop or stay at the last frame
+	loop bool
+}
+
+// frame at elapsed time since the animation started
+func (a animation) frame(elapsed time.Duration) *ebiten.Image {
+	i := int(elapsed * time.Duration(a.frames) / a.duration)
+	if a.loop {
+		i %= a.frames
+	} else if i >= a.frames {
+		i = a.frames - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return a.sheet.frame(i, a.row)
+}
+
+// sprites are all sheets of the game, loaded once by the renderer
+type sprites struct {
+	player, bomb, flame, block *spriteSheet
+	// the squares of the item spawners and under the local players
+	item, highlight *ebiten.Image
+}
+
+func loadSprites() *sprites {
+	item := ebiten.NewImage(gridSize/2, gridSize/2)
+	item.Fill(itemSpawnerColor)
+	highlight := ebiten.NewImage(gridSize+2, gridSize+2)
+	highlight.Fill(localPlayerHighlightColor)
+	return &sprites{
+		player:    loadSpriteSheet("player.png"),
+		bomb:      loadSpriteSheet("bomb.png"),
+		flame:     loadSpriteSheet("flame.png"),
+		block:     loadSpriteSheet("block.png"),
+		item:      item,
+		highlight: highlight,
+	}
+}
+
+func (s *sprites) walk(dir Direction) animation {
+	row := map[Direction]int{
+		dirNone:  playerRowDown,
+		dirDown:  playerRowDown,
+		dirLeft:  playerRowLeft,
+		dirRight: playerRowRight,
+		dirUp:    playerRowUp,
+	}[dir]
+	return animation{sheet: s.player, row: row, frames: 4, duration: walkDuration, loop: true}
+}
+
+func (s *sprites) death() animation {
+	return animation{sheet: s.player, row: playerRowDeath, frames: 4, duration: deathDuration}
+}
+
+func (s *sprites) bombFuse() animation {
+	return animation{sheet: s.bomb, frames: 4, duration: bombPulsePeriod, loop: true}
+}
+
+func (s *sprites) crumbling(elapsed time.Duration) *ebiten.Image {
+	i := int(elapsed * crumbleFrames / crumbleDuration)
+	if i >= crumbleFrames {
+		i = crumbleFrames - 1
+	}
+	return s.block.frame(blockColCrumble+i, 0)
+}
+
+func (s *sprites) flamePiece(col int, elapsed time.Duration) *ebiten.Image {
+	return s.flame.frame(col, int(elapsed/flameFlickerTime)%2)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"strings"
+)
+
+// connectionConfig tell how to reach pulsar, it is saved in the config file
+// and the command line overrides it
+type connectionConfig struct {
+	URL string `json:"url"`
+	// token auth, the token itself or a file holding it
+	Token     string `json:"token,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	// oauth2 client credentials auth
+	OAuth2 *oauth2Config `json:"oauth2,omitempty"`
+
+	// tls of pulsar+ssl urls: the certificates trusted to sign the certificate of the broker,
+	// the system ones if empty. The broker always has to match the hostname of the url.
+	TLSTrustCertsFile string `json:"tlsTrustCertsFile,omitempty"`
+	// client certificate auth, when there is no token
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty"`
+
+	// the namespace of the key topics of the players, empty for the default one
+	KeyNamespace string `json:"keyNamespace,omitempty"`
+}
+
+type oauth2Config struct {
+	IssuerURL string `json:"issuerUrl"`
+	// the json file of the client id and secret
+	PrivateKey string `json:"privateKey"`
+	Audience   string `json:"audience,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+}
+
+var defaultConnection = connectionConfig{URL: pulsarUrl}
+
+// validate report settings which can't work together
+func (c connectionConfig) validate() error {
+	secure := strings.HasPrefix(c.URL, "pulsar+ssl://")
+	if !secure && !strings.HasPrefix(c.URL, "pulsar://") {
+		return fmt.Errorf("the url %q is neither pulsar:// nor pulsar+ssl://", c.URL)
+	}
+	if !secure && (c.TLSTrustCertsFile != "" || c.TLSCertFile != "") {
+		return errors.New("tls settings need a pulsar+ssl:// url")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("a client certificate needs its key")
+	}
+	return nil
+}
+
+// authenticated reports whether the player has to log in
+func (c connectionConfig) authenticated() bool {
+	return c.Token != "" || c.TokenFile != "" || c.OAuth2 != nil || c.TLSCertFile != ""
+}
+
+// authentication provider of the config, nil to connect anonymously
+func (c connectionConfig) authentication() pulsar.Authentication {
+	switch {
+	case c.Token != "":
+		return pulsar.NewAuthenticationToken(c.Token)
+	case c.TokenFile != "":
+		return pulsar.NewAuthenticationTokenFromFile(c.TokenFile)
+	case c.OAuth2 != nil:
+		params := map[string]string{
+			"type":       "client_credentials",
+			"issuerUrl":  c.OAuth2.IssuerURL,
+			"privateKey": c.OAuth2.PrivateKey,
+			"audience":   c.OAuth2.Audience,
+		}
+		if c.OAuth2.Scope != "" {
+			params["scope"] = c.OAuth2.Scope
+		}
+		return pulsar.NewAuthenticationOAuth2(params)
+	case c.TLSCertFile != "":
+		return pulsar.NewAuthenticationTLS(c.TLSCertFile, c.TLSKeyFile)
+	}
+	return nil
+}
+
+// newClient connect to pulsar
+func (c connectionConfig) newClient() (pulsar.Client, error) {
+	return pulsar.NewClient(c.clientOptions())
+}
+
+// clientOptions of the pulsar client of the config
+func (c connectionConfig) clientOptions() pulsar.ClientOptions {
+	options := pulsar.ClientOptions{
+		URL:                   c.URL,
+		TLSTrustCertsFilePath: c.TLSTrustCertsFile,
+		// the tls dialer of pulsar checks the hostname anyway
+		TLSValidateHostname: true,
+	}
+	if auth := c.authentication(); auth != nil {
+		options.Authentication = auth
+	}
+	return options
+}
+
+// tokenProvider is what the token and oauth2 providers of pulsar have in common
+type tokenProvider interface {
+	Init() error
+	GetData() ([]byte, error)
+	Close() error
+}
+
+// subject of the token the player logs in with, the broker checks the signature of the token.
+// With a client certificate, it is the common name of the certificate.
+func (c connectionConfig) subject() (string, error) {
+	if c.Token == "" && c.TokenFile == "" && c.OAuth2 == nil && c.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return "", err
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return "", err
+		}
+		if leaf.Subject.CommonName == "" {
+			return "", errors.New("the client certificate has no common name")
+		}
+		return leaf.Subject.CommonName, nil
+	}
+	provider, ok := c.authentication().(tokenProvider)
+	if !ok {
+		return "", errors.New("no token")
+	}
+	defer provider.Close()
+	if err := provider.Init(); err != nil {
+		return "", err
+	}
+	token, err := provider.GetData()
+	if err != nil {
+		return "", err
+	}
+	return jwtSubject(strings.TrimSpace(string(token)))
+}
+
+// jwtSubject read the sub claim of a jwt without checking its signature
+func jwtSubject(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("the token is not a jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid jwt payload: %w", err)
+	}
+	claims := struct {
+		Sub string `json:"sub"`
+	}{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("invalid jwt claims: %w", err)
+	}
+	if claims.Sub == "" {
+		return "", errors.New("the token has no subject")
+	}
+	return claims.Sub, nil
+}
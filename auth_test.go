@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConnectionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		c    connectionConfig
+		ok   bool
+	}{
+		{"plain", connectionConfig{URL: "pulsar://localhost:6650"}, true},
+		{"tls", connectionConfig{URL: "pulsar+ssl://localhost:6651", TLSTrustCertsFile: "ca.pem"}, true},
+		{"client certificate", connectionConfig{URL: "pulsar+ssl://localhost:6651", TLSCertFile: "c.pem", TLSKeyFile: "c.key"}, true},
+		{"http url", connectionConfig{URL: "http://localhost:8080"}, false},
+		{"no url", connectionConfig{}, false},
+		{"trusted certificates without tls", connectionConfig{URL: "pulsar://localhost:6650", TLSTrustCertsFile: "ca.pem"}, false},
+		{"client certificate without tls", connectionConfig{URL: "pulsar://localhost:6650", TLSCertFile: "c.pem", TLSKeyFile: "c.key"}, false},
+		{"client certificate without key", connectionConfig{URL: "pulsar+ssl://localhost:6651", TLSCertFile: "c.pem"}, false},
+		{"key without client certificate", connectionConfig{URL: "pulsar+ssl://localhost:6651", TLSKeyFile: "c.key"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.validate(); (err == nil) != tt.ok {
+				t.Errorf("validate = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+// testCA is a certificate authority writing its certificates in dir
+type testCA struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// the pem file of the certificate
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	ca := &testCA{dir: dir}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	ca.cert, ca.key, ca.file, _ = ca.issue(t, name, template)
+	return ca
+}
+
+// issue a certificate of template signed by the ca, self-signed for the ca itself,
+// return the certificate, its key and their pem files
+func (ca *testCA) issue(t *testing.T, name string, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, parentKey := ca.cert, ca.key
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(ca.dir, name+".pem")
+	keyFile := filepath.Join(ca.dir, name+".key")
+	writePem(t, certFile, "CERTIFICATE", der)
+	writePem(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return cert, key, certFile, keyFile
+}
+
+func writePem(t *testing.T, file, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS stand in for a broker: it accepts tls connections with the certificate in
+// certFile and reports the first handshake, with the common name of the client certificate
+func serveTLS(t *testing.T, certFile, keyFile string) (string, chan error, chan string) {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	handshakes := make(chan error, 1)
+	clients := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := tls.Server(conn, &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientAuth:   tls.RequestClientCert,
+			})
+			err = tlsConn.Handshake()
+			select {
+			case handshakes <- err:
+				if err == nil && len(tlsConn.ConnectionState().PeerCertificates) > 0 {
+					clients <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+				}
+			default:
+			}
+			// the stand in never answers, until the client gives up
+			go func() {
+				io.Copy(io.Discard, tlsConn)
+				tlsConn.Close()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, handshakes, clients
+}
+
+// connect with c until the first handshake with the stand in broker
+func connect(t *testing.T, c connectionConfig, handshakes chan error) error {
+	t.Helper()
+	options := c.clientOptions()
+	options.ConnectionTimeout = 2 * time.Second
+	options.OperationTimeout = 2 * time.Second
+	client, err := pulsar.NewClient(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go client.TopicPartitions("test")
+	select {
+	case err = <-handshakes:
+		return err
+	case <-time.After(10 * time.Second):
+		return errors.New("no handshake")
+	}
+}
+
+func TestTLSConnection(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	other := newTestCA(t, dir, "other-ca")
+	_, _, brokerCert, brokerKey := ca.issue(t, "broker", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	_, _, elsewhereCert, elsewhereKey := ca.issue(t, "elsewhere", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "broker.example.com"},
+		DNSNames:    []string{"broker.example.com"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	_, _, clientCert, clientKey := ca.issue(t, "alice", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alice"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	t.Run("trusted ca", func(t *testing.T) {
+		port, handshakes, _ := serveTLS(t, brokerCert, brokerKey)
+		c := connectionConfig{URL: "pulsar+ssl://127.0.0.1:" + port, TLSTrustCertsFile: ca.file}
+		if err := connect(t, c, handshakes); err != nil {
+			t.Error("handshake:", err)
+		}
+	})
+	t.Run("unknown ca", func(t *testing.T) {
+		port, handshakes, _ := serveTLS(t, brokerCert, brokerKey)
+		c := connectionConfig{URL: "pulsar+ssl://127.0.0.1:" + port, TLSTrustCertsFile: other.file}
+		if err := connect(t, c, handshakes); err == nil {
+			t.Error("a broker signed by an unknown ca is trusted")
+		}
+	})
+	t.Run("hostname mismatch", func(t *testing.T) {
+		port, handshakes, _ := serveTLS(t, elsewhereCert, elsewhereKey)
+		c := connectionConfig{URL: "pulsar+ssl://127.0.0.1:" + port, TLSTrustCertsFile: ca.file}
+		if err := connect(t, c, handshakes); err == nil {
+			t.Error("a broker with the certificate of another host is trusted")
+		}
+	})
+	t.Run("client certificate", func(t *testing.T) {
+		port, handshakes, clients := serveTLS(t, brokerCert, brokerKey)
+		c := connectionConfig{
+			URL:               "pulsar+ssl://127.0.0.1:" + port,
+			TLSTrustCertsFile: ca.file,
+			TLSCertFile:       clientCert,
+			TLSKeyFile:        clientKey,
+		}
+		if err := connect(t, c, handshakes); err != nil {
+			t.Fatal("handshake:", err)
+		}
+		if name := <-clients; name != "alice" {
+			t.Errorf("the client presented %q, want alice", name)
+		}
+		subject, err := c.subject()
+		if err != nil || subject != "alice" {
+			t.Errorf("subject = %q, %v, want alice", subject, err)
+		}
+	})
+}
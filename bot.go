@@ -0,0 +1,310 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// difficulty tunes how well a bot plays
+type difficulty struct {
+	// time between two decisions
+	reaction time.Duration
+	// cells per second
+	speed float64
+	// chance to ignore danger in a decision
+	careless float64
+	// predict that bombs in the flames of another bomb explode with it
+	chains bool
+	// chase players, otherwise wander and break obstacles
+	hunt bool
+	// how many bombs of the bot can be on the map at once
+	bombs int
+}
+
+var difficulties = map[string]difficulty{
+	"easy":   {reaction: 600 * time.Millisecond, speed: 4, careless: 0.3, bombs: 1},
+	"normal": {reaction: 300 * time.Millisecond, speed: 6, careless: 0.05, hunt: true, bombs: 1},
+	"hard":   {reaction: 120 * time.Millisecond, speed: 8, chains: true, hunt: true, bombs: 2},
+}
+
+// difficultyNames list the valid difficulties from the easiest
+func difficultyNames() []string {
+	names := make([]string, 0, len(difficulties))
+	for name := range difficulties {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return difficulties[names[i]].reaction > difficulties[names[j]].reaction
+	})
+	return names
+}
+
+// a dead bot revives after botReviveDelay
+const botReviveDelay = 3 * time.Second
+
+// bot is a player played by the computer, it sends the same events as a local player
+type bot struct {
+	name  string
+	level difficulty
+	mover *mover
+	rng   *rand.Rand
+
+	// cells to walk, the first one is next to the bot
+	path []Position
+	// set a bomb in the next tick
+	bombNow   bool
+	decidedAt time.Time
+	diedAt    time.Time
+}
+
+func newBot(name string, level difficulty, seed int64) *bot {
+	return &bot{
+		name:  name,
+		level: level,
+		mover: newMover(level.speed),
+		rng:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// updateBot decide and send the events of a bot in this tick
+func (g *Game) updateBot(b *bot) {
+	player := g.nameToPlayers[b.name]
+	now := g.clock.Now()
+	var in intent
+	if !player.alive {
+		if b.diedAt.IsZero() {
+			b.diedAt = now
+		}
+		if now.Sub(b.diedAt) > botReviveDelay && !g.elimination {
+			in.revive = true
+			b.diedAt = time.Time{}
+			b.path = nil
+		}
+		g.act(b.name, b.mover, in)
+		return
+	}
+
+	if now.Sub(b.decidedAt) >= b.level.reaction {
+		b.decidedAt = now
+		b.decide(g, player.pos, now)
+	}
+
+	for len(b.path) > 0 && b.path[0] == player.pos {
+		b.path = b.path[1:]
+	}
+	if len(b.path) > 0 {
+		if dir := direction(player.pos, b.path[0]); dir != dirNone {
+			in.held = map[Direction]bool{dir: true}
+		} else {
+			// teleported, plan again
+			b.path = nil
+		}
+	}
+	if b.bombNow {
+		in.bomb = true
+		b.bombNow = false
+	}
+	g.act(b.name, b.mover, in)
+}
+
+// decide plan the path of the bot: escape danger first, then attack, then go to a target
+func (b *bot) decide(g *Game, pos Position, now time.Time) {
+	danger := g.dangerZones(now, b.level.chains)
+	if _, ok := danger[pos]; ok && b.rng.Float64() >= b.level.careless {
+		b.path = g.route(pos, danger, b.level.speed, func(p Position) bool {
+			_, ok := danger[p]
+			return !ok
+		})
+		return
+	}
+
+	enemies := map[Position]bool{}
+	for name, player := range g.nameToPlayers {
+		if name != b.name && player.alive {
+			enemies[player.pos] = true
+		}
+	}
+	flames := g.flamePositions(pos)
+	hit := false
+	for _, p := range flames {
+		if enemies[p] {
+			hit = true
+			break
+		}
+	}
+
+	var path []Position
+	if b.level.hunt && !hit {
+		// go next to the closest player
+		path = g.route(pos, danger, b.level.speed, func(p Position) bool {
+			for _, dir := range []Direction{dirNone, dirLeft, dirRight, dirDown, dirUp} {
+				if enemies[g.size.getNextPosition(p, dir)] {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if path == nil && !hit {
+		if g.nextToBlock(pos) {
+			// break the way
+			hit = true
+		} else {
+			path = g.route(pos, danger, b.level.speed, func(p Position) bool {
+				if !b.level.hunt && b.rng.Intn(30) == 0 {
+					// wander
+					return true
+				}
+				return g.nextToBlock(p)
+			})
+		}
+	}
+
+	if hit && g.bombsOf(b.name) < b.level.bombs && g.posToBombs[pos] == nil {
+		// only set a bomb with a way out
+		withBomb := map[Position]time.Duration{}
+		for p, t := range danger {
+			withBomb[p] = t
+		}
+		for _, p := range flames {
+			if t, ok := withBomb[p]; !ok || t > explodeTime*time.Second {
+				withBomb[p] = explodeTime * time.Second
+			}
+		}
+		escape := g.route(pos, withBomb, b.level.speed, func(p Position) bool {
+			_, ok := withBomb[p]
+			return !ok
+		})
+		if escape != nil {
+			b.bombNow = true
+			b.path = escape
+			return
+		}
+	}
+	b.path = path
+}
+
+// dangerZones map the grids which will burn to the time until they burn, burning grids map to 0.
+// With chains, a bomb in the flames of another bomb explodes with it.
+func (g *Game) dangerZones(now time.Time, chains bool) map[Position]time.Duration {
+	danger := map[Position]time.Duration{}
+	g.flameLock.RLock()
+	for pos, bomb := range g.flameMap {
+		if bomb != nil {
+			danger[pos] = 0
+		}
+	}
+	g.flameLock.RUnlock()
+
+	fuses := map[*Bomb]time.Duration{}
+	flames := map[*Bomb][]Position{}
+	for _, bomb := range g.nameToBombs {
+		fuse := explodeTime*time.Second - now.Sub(bomb.setTime)
+		if fuse < 0 {
+			fuse = 0
+		}
+		fuses[bomb] = fuse
+		flames[bomb] = g.flamePositions(bomb.pos)
+	}
+	for changed := chains; changed; {
+		changed = false
+		for bomb, positions := range flames {
+			for _, p := range positions {
+				if other, ok := g.posToBombs[p]; ok && fuses[other] > fuses[bomb] {
+					fuses[other] = fuses[bomb]
+					changed = true
+				}
+			}
+		}
+	}
+	for bomb, positions := range flames {
+		for _, p := range positions {
+			if !g.size.validCoordinate(p) {
+				continue
+			}
+			if t, ok := danger[p]; !ok || fuses[bomb] < t {
+				danger[p] = fuses[bomb]
+			}
+		}
+	}
+	return danger
+}
+
+// route find the shortest walk from start to a grid where goal is true, avoiding obstacles,
+// bombs and grids burning while the bot walks through at speed.
+// The path doesn't include start, it is nil if no grid is found.
+func (g *Game) route(start Position, danger map[Position]time.Duration, speed float64, goal func(Position) bool) []Position {
+	step := time.Duration(float64(time.Second) / speed)
+	prev := map[Position]Position{start: start}
+	dist := map[Position]int{start: 0}
+	queue := []Position{start}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		if pos != start && goal(pos) {
+			var path []Position
+			for p := pos; p != start; p = prev[p] {
+				path = append([]Position{p}, path...)
+			}
+			return path
+		}
+		for _, dir := range []Direction{dirLeft, dirRight, dirDown, dirUp} {
+			next := g.size.getNextPosition(pos, dir)
+			if _, ok := prev[next]; ok {
+				continue
+			}
+			if g.blocked(next) || g.posToBombs[next] != nil {
+				continue
+			}
+			arrival := time.Duration(dist[pos]+1) * step
+			if t, ok := danger[next]; ok && arrival+step > t && arrival < t+flameTime*time.Second {
+				// burning when the bot is there
+				continue
+			}
+			prev[next] = pos
+			dist[next] = dist[pos] + 1
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// nextToBlock reports whether a destructible obstacle is next to pos
+func (g *Game) nextToBlock(pos Position) bool {
+	g.obstacleLock.RLock()
+	defer g.obstacleLock.RUnlock()
+	for _, dir := range []Direction{dirLeft, dirRight, dirDown, dirUp} {
+		next := g.size.getNextPosition(pos, dir)
+		if t, ok := g.obstacleMap[next]; ok && next != pos && t == destructibleObstacleType {
+			return true
+		}
+	}
+	return false
+}
+
+// bombsOf count the bombs of a player on the map
+func (g *Game) bombsOf(name string) int {
+	n := 0
+	for _, bomb := range g.nameToBombs {
+		if bomb.playerName == name {
+			n++
+		}
+	}
+	return n
+}
+
+// direction from a grid to a grid next to it, dirNone if they are not neighbours
+func direction(from, to Position) Direction {
+	switch {
+	case to.X == from.X-1 && to.Y == from.Y:
+		return dirLeft
+	case to.X == from.X+1 && to.Y == from.Y:
+		return dirRight
+	case to.Y == from.Y-1 && to.X == from.X:
+		return dirUp
+	case to.Y == from.Y+1 && to.X == from.X:
+		return dirDown
+	}
+	return dirNone
+}
@@ -0,0 +1,78 @@
+package main
+
+import "image"
+
+const (
+	// the map is drawn above the score bar
+	viewWidth  = screenWidth
+	viewHeight = screenHeight - scoreBarHeight
+	// the camera moves cameraSmoothing of the distance to its target every tick
+	cameraSmoothing = 0.15
+)
+
+// camera is the top left pixel of the map shown in its viewport
+type camera struct {
+	x, y float64
+	// the part of the screen showing the map, zero for the whole view
+	viewport image.Rectangle
+}
+
+func newCamera(viewport image.Rectangle) camera {
+	return camera{viewport: viewport}
+}
+
+// follow moves the camera smoothly to center on target, but never shows outside the map
+func (c *camera) follow(target Position, size mapSize) {
+	w, h := c.viewSize()
+	tx := clampView(float64(target.X*gridSize+gridSize/2-w/2), size.width*gridSize, w)
+	ty := clampView(float64(target.Y*gridSize+gridSize/2-h/2), size.height*gridSize, h)
+	c.x += (tx - c.x) * cameraSmoothing
+	c.y += (ty - c.y) * cameraSmoothing
+}
+
+// screenXY is the position of a grid on the screen
+func (c *camera) screenXY(pos Position) (float64, float64) {
+	return c.screenXYf(float64(pos.X), float64(pos.Y))
+}
+
+// screenXYf is screenXY for the positions between grids
+func (c *camera) screenXYf(x, y float64) (float64, float64) {
+	return x*gridSize - c.x + float64(c.viewport.Min.X), y*gridSize - c.y + float64(c.viewport.Min.Y)
+}
+
+func (c *camera) viewSize() (int, int) {
+	if c.viewport.Empty() {
+		return viewWidth, viewHeight
+	}
+	return c.viewport.Dx(), c.viewport.Dy()
+}
+
+// viewports split the view among n local players: side by side for two, a grid of four for more
+func viewports(n int) []image.Rectangle {
+	switch {
+	case n <= 1:
+		return []image.Rectangle{image.Rect(0, 0, viewWidth, viewHeight)}
+	case n == 2:
+		return []image.Rectangle{
+			image.Rect(0, 0, viewWidth/2, viewHeight),
+			image.Rect(viewWidth/2, 0, viewWidth, viewHeight),
+		}
+	}
+	rects := make([]image.Rectangle, 0, n)
+	for i := 0; i < n; i++ {
+		x, y := i%2*viewWidth/2, i/2*viewHeight/2
+		rects = append(rects, image.Rect(x, y, x+viewWidth/2, y+viewHeight/2))
+	}
+	return rects
+}
+
+// clampView keeps [v, v+view) inside [0, length), a map smaller than the view stays at 0
+func clampView(v float64, length, view int) float64 {
+	if max := float64(length - view); v > max {
+		v = max
+	}
+	if v < 0 {
+		v = 0
+	}
+	return v
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"strings"
+	"time"
+)
+
+const (
+	// longer messages are cut
+	maxChatLength = 100
+	// a player can send chatBurst messages every chatRateWindow,
+	// more messages are refused when sending and dropped when receiving
+	chatBurst      = 3
+	chatRateWindow = 5 * time.Second
+	// how many messages the overlay shows, and for how long
+	chatLines    = 6
+	chatFadeTime = 10 * time.Second
+)
+
+// ChatEvent is a message sent to the chat topic of the room
+type ChatEvent struct {
+	sender string
+	text   string
+}
+
+func (e *ChatEvent) handle(game *Game) {
+	if !game.chat.allow(e.sender, time.Now()) {
+		// spamming
+		return
+	}
+	game.chat.add(e.sender, sanitizeChat(e.text))
+}
+
+// chatMessage is a line in the overlay, sender is empty for system messages
+type chatMessage struct {
+	sender string
+	text   string
+	at     time.Time
+}
+
+// chat keeps the recent messages and the input box of the local players
+type chat struct {
+	messages []chatMessage
+	// when the recent messages of every sender were sent, for rate limiting
+	sent map[string][]time.Time
+
+	// the local player typing, empty when the input box is closed
+	typing string
+	input  []rune
+}
+
+// allow reports whether sender can send a message at now, and records it if so
+func (c *chat) allow(sender string, now time.Time) bool {
+	if c.sent == nil {
+		c.sent = map[string][]time.Time{}
+	}
+	recent := c.sent[sender][:0]
+	for _, t := range c.sent[sender] {
+		if now.Sub(t) < chatRateWindow {
+			recent = append(recent, t)
+		}
+	}
+	c.sent[sender] = recent
+	if len(recent) >= chatBurst {
+		return false
+	}
+	c.sent[sender] = append(recent, now)
+	return true
+}
+
+func (c *chat) add(sender, text string) {
+	if text == "" {
+		return
+	}
+	c.messages = append(c.messages, chatMessage{sender: sender, text: text, at: time.Now()})
+	if len(c.messages) > chatLines {
+		c.messages = c.messages[len(c.messages)-chatLines:]
+	}
+}
+
+// system add a message of the game itself
+func (c *chat) system(format string, args ...interface{}) {
+	c.add("", fmt.Sprintf(format, args...))
+}
+
+// sanitizeChat drop control characters and cut long messages
+func sanitizeChat(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, text)
+	text = strings.TrimSpace(text)
+	if runes := []rune(text); len(runes) > maxChatLength {
+		text = string(runes[:maxChatLength])
+	}
+	return text
+}
+
+// updateChat handle the input box, return true while a local player is typing,
+// then the keyboard belongs to the chat
+func (g *Game) updateChat() bool {
+	if g.chat.typing == "" {
+		for _, lp := range g.localPlayers {
+			if !lp.rebinder.active && lp.controls.justPressed(actionChat) {
+				g.chat.typing = lp.name
+				g.chat.input = g.chat.input[:0]
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		g.chat.typing = ""
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		text := sanitizeChat(string(g.chat.input))
+		if name, ok := profileCommand(text, g.chat.typing); ok {
+			// commands are not sent to the room
+			g.showProfile(name)
+		} else if text != "" {
+			// the echo of the message is counted as the sender's,
+			// names never contain "-" so the local count is apart
+			if g.chat.allow(g.chat.typing+"-local", time.Now()) {
+				g.sendAsync(&ChatEvent{sender: g.chat.typing, text: text})
+			} else {
+				g.chat.system("slow down, %d messages every %s", chatBurst, chatRateWindow)
+			}
+		}
+		g.chat.typing = ""
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackspace):
+		if len(g.chat.input) > 0 {
+			g.chat.input = g.chat.input[:len(g.chat.input)-1]
+		}
+	default:
+		g.chat.input = ebiten.AppendInputChars(g.chat.input)
+		if len(g.chat.input) > maxChatLength {
+			g.chat.input = g.chat.input[:maxChatLength]
+		}
+	}
+	return true
+}
+
+// drawChat print the recent messages and the input box at the bottom left of the view
+func (r *renderer) drawChat(g *Game, screen *ebiten.Image) {
+	now := time.Now()
+	var lines []string
+	for _, m := range g.chat.messages {
+		// keep all messages while typing
+		if g.chat.typing == "" && now.Sub(m.at) > chatFadeTime {
+			continue
+		}
+		if m.sender == "" {
+			lines = append(lines, "* "+m.text)
+		} else {
+			lines = append(lines, m.sender+": "+m.text)
+		}
+	}
+	if g.chat.typing != "" {
+		lines = append(lines, "> "+g.chat.typing+": "+string(g.chat.input)+"_")
+	}
+	y := viewHeight - len(lines)*debugCharHeight
+	for _, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, 0, y)
+		y += debugCharHeight
+	}
+}
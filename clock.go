@@ -0,0 +1,75 @@
+package main
+
+import "time"
+
+// clock tells the time of a game and runs its timers,
+// simulations replace the wall clock to run faster than real time
+type clock interface {
+	Now() time.Time
+	// AfterFunc call f after d
+	AfterFunc(d time.Duration, f func())
+}
+
+// realClock is the wall clock, timers run in their own goroutine
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) {
+	time.AfterFunc(d, f)
+}
+
+// simClock only moves when advanced, timers run in the goroutine calling advance
+type simClock struct {
+	now    time.Time
+	timers []simTimer
+	// order of timers due at the same time
+	seq int
+}
+
+type simTimer struct {
+	at  time.Time
+	seq int
+	f   func()
+}
+
+func newSimClock() *simClock {
+	return &simClock{now: time.Unix(0, 0)}
+}
+
+func (c *simClock) Now() time.Time {
+	return c.now
+}
+
+func (c *simClock) AfterFunc(d time.Duration, f func()) {
+	c.seq++
+	c.timers = append(c.timers, simTimer{at: c.now.Add(d), seq: c.seq, f: f})
+}
+
+// advance move the clock by d and run the timers due in order,
+// timers added by them run too if they are due
+func (c *simClock) advance(d time.Duration) {
+	end := c.now.Add(d)
+	for {
+		next := -1
+		for i, t := range c.timers {
+			if t.at.After(end) {
+				continue
+			}
+			if next < 0 || t.at.Before(c.timers[next].at) ||
+				(t.at.Equal(c.timers[next].at) && t.seq < c.timers[next].seq) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		t := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		c.now = t.at
+		t.f()
+	}
+	c.now = end
+}
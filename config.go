@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/hajimehoshi/ebiten/v2"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const configFileName = "config.json"
+
+// bindings of a local player
+type bindings struct {
+	// key bindings of every action
+	Keys map[action][]ebiten.Key `json:"keys"`
+	// standard gamepad button bindings of every action, see gamepadButtonNames
+	Buttons map[action][]string `json:"buttons"`
+	// index of the gamepad among connected gamepads, -1 for no gamepad
+	Gamepad int `json:"gamepad"`
+}
+
+// config is saved as json in the user config directory
+type config struct {
+	// bindings of every local player, the first one is used when playing alone
+	Players []bindings `json:"players"`
+	// stick values below deadzone are ignored
+	Deadzone float64 `json:"deadzone"`
+	// how deaths are scored
+	Scoring scoreRules `json:"scoring"`
+	// how to reach pulsar
+	Connection connectionConfig `json:"connection"`
+}
+
+// configFile is the config file as written, settings missing in it keep the default
+type configFile struct {
+	config
+	Players []fileBindings `json:"players"`
+	// bindings of the single player of config files before the local players had their own
+	Keys    map[action][]ebiten.Key `json:"keys"`
+	Buttons map[action][]string     `json:"buttons"`
+}
+
+// fileBindings are the bindings of a player in the config file
+type fileBindings struct {
+	bindings
+	// nil if missing, 0 is the first gamepad
+	Gamepad *int `json:"gamepad"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		Players:    defaultBindings(),
+		Deadzone:   defaultDeadzone,
+		Scoring:    defaultScoreRules,
+		Connection: defaultConnection,
+	}
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pulsar-game", configFileName), nil
+}
+
+// loadConfig read the config file, actions missing in the file keep the default bindings
+func loadConfig() (*config, error) {
+	cfg := defaultConfig()
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+// parseConfig read the config file data over the default config
+func parseConfig(data []byte) (*config, error) {
+	cfg := defaultConfig()
+	// score rules and connection settings missing in the file keep the default
+	fileCfg := &configFile{config: config{Scoring: cfg.Scoring, Connection: cfg.Connection}}
+	if err := json.Unmarshal(data, fileCfg); err != nil {
+		return nil, err
+	}
+	if len(fileCfg.Players) == 0 && (fileCfg.Keys != nil || fileCfg.Buttons != nil) {
+		// an old config file, its bindings are the first player's
+		fileCfg.Players = []fileBindings{{bindings: bindings{Keys: fileCfg.Keys, Buttons: fileCfg.Buttons}}}
+	}
+	for i, b := range fileCfg.Players {
+		if i >= len(cfg.Players) {
+			break
+		}
+		for a, keys := range b.Keys {
+			cfg.Players[i].Keys[a] = keys
+		}
+		for a, buttons := range b.Buttons {
+			cfg.Players[i].Buttons[a] = buttons
+		}
+		if b.Gamepad != nil {
+			cfg.Players[i].Gamepad = *b.Gamepad
+		}
+	}
+	if fileCfg.Deadzone > 0 {
+		cfg.Deadzone = fileCfg.Deadzone
+	}
+	cfg.Scoring = fileCfg.Scoring
+	cfg.Connection = fileCfg.Connection
+	return cfg, nil
+}
+
+func (c *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
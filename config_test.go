@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// check the config read
+		check func(t *testing.T, cfg *config)
+	}{
+		{
+			name: "gamepads missing keep the default",
+			data: `{"players": [{"keys": {"bomb": [` + keyJSON(ebiten.KeyB) + `]}}, {}]}`,
+			check: func(t *testing.T, cfg *config) {
+				if cfg.Players[0].Gamepad != 0 || cfg.Players[1].Gamepad != 1 {
+					t.Errorf("gamepads %d, %d, want 0, 1", cfg.Players[0].Gamepad, cfg.Players[1].Gamepad)
+				}
+				if !reflect.DeepEqual(cfg.Players[0].Keys[actionBomb], []ebiten.Key{ebiten.KeyB}) {
+					t.Errorf("bomb keys %v, want B", cfg.Players[0].Keys[actionBomb])
+				}
+				if len(cfg.Players[0].Keys[actionLeft]) == 0 {
+					t.Error("the default keys of the other actions are lost")
+				}
+			},
+		},
+		{
+			name: "gamepads",
+			data: `{"players": [{"gamepad": -1}, {"gamepad": 0}]}`,
+			check: func(t *testing.T, cfg *config) {
+				if cfg.Players[0].Gamepad != -1 || cfg.Players[1].Gamepad != 0 {
+					t.Errorf("gamepads %d, %d, want -1, 0", cfg.Players[0].Gamepad, cfg.Players[1].Gamepad)
+				}
+			},
+		},
+		{
+			name: "single player config",
+			data: `{"keys": {"bomb": [` + keyJSON(ebiten.KeyB) + `]}, "buttons": {"bomb": ["x"]}, "deadzone": 0.3}`,
+			check: func(t *testing.T, cfg *config) {
+				if !reflect.DeepEqual(cfg.Players[0].Keys[actionBomb], []ebiten.Key{ebiten.KeyB}) {
+					t.Errorf("bomb keys %v, want B", cfg.Players[0].Keys[actionBomb])
+				}
+				want := []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightLeft}
+				if buttons := newControls(cfg, 0).buttons[actionBomb]; !reflect.DeepEqual(buttons, want) {
+					t.Errorf("bomb buttons %v, want x", buttons)
+				}
+				if cfg.Players[0].Gamepad != 0 || cfg.Deadzone != 0.3 {
+					t.Errorf("gamepad %d, deadzone %v, want 0, 0.3", cfg.Players[0].Gamepad, cfg.Deadzone)
+				}
+			},
+		},
+		{
+			name: "unknown button",
+			data: `{"buttons": {"bomb": ["turbo", "b"], "revive": ["turbo"]}}`,
+			check: func(t *testing.T, cfg *config) {
+				c := newControls(cfg, 0)
+				want := []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightRight}
+				if !reflect.DeepEqual(c.buttons[actionBomb], want) {
+					t.Errorf("bomb buttons %v, want b without the unknown button", c.buttons[actionBomb])
+				}
+				if len(c.buttons[actionRevive]) != 0 {
+					t.Errorf("revive buttons %v, want none", c.buttons[actionRevive])
+				}
+				if len(c.buttons[actionLeft]) == 0 {
+					t.Error("the default buttons of the other actions are lost")
+				}
+			},
+		},
+		{
+			name: "empty",
+			data: `{}`,
+			check: func(t *testing.T, cfg *config) {
+				if !reflect.DeepEqual(cfg, defaultConfig()) {
+					t.Errorf("config %+v, want the default", cfg)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func keyJSON(k ebiten.Key) string {
+	data, err := k.MarshalText()
+	if err != nil {
+		panic(err)
+	}
+	return `"` + string(data) + `"`
+}
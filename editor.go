@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+)
+
+type editorTool int
+
+const (
+	toolWall editorTool = iota
+	toolBlock
+	toolSpawn
+	toolItemSpawner
+	toolErase
+)
+
+var toolNames = map[editorTool]string{
+	toolWall:        "wall",
+	toolBlock:       "block",
+	toolSpawn:       "spawn",
+	toolItemSpawner: "item spawner",
+	toolErase:       "erase",
+}
+
+// Editor is an ebiten game to paint maps with the mouse
+type Editor struct {
+	name, roomName string
+	// what is painted on every cell, toolErase is never stored
+	cells map[Position]editorTool
+	tool  editorTool
+	size  mapSize
+	// scrolled by arrow keys
+	camera camera
+	// message shown in the status bar
+	status string
+	// to publish the map to the room
+	connection connectionConfig
+	// the status of a publish in progress when it ends, nil when there is none
+	publishCh chan string
+}
+
+// newEditor edit the map mapName, create a new one with size if it doesn't exist
+func newEditor(mapName, roomName string, size mapSize, conn connectionConfig) *Editor {
+	if mapName == "" {
+		mapName = "untitled"
+	}
+	e := &Editor{
+		name:       mapName,
+		roomName:   roomName,
+		cells:      map[Position]editorTool{},
+		size:       size,
+		status:     "1 wall, 2 block, 3 spawn, 4 item, 5 erase, arrows scroll, S save, P publish",
+		connection: conn,
+	}
+	if m, err := loadMapByName(mapName); err == nil {
+		e.size = m.size()
+		for tool, positions := range map[editorTool][]Position{
+			toolWall:        m.Walls,
+			toolBlock:       m.Blocks,
+			toolSpawn:       m.Spawns,
+			toolItemSpawner: m.ItemSpawners,
+		} {
+			for _, p := range positions {
+				e.cells[p] = tool
+			}
+		}
+	}
+	return e
+}
+
+func (e *Editor) Update() error {
+	for key, tool := range map[ebiten.Key]editorTool{
+		ebiten.Key1: toolWall,
+		ebiten.Key2: toolBlock,
+		ebiten.Key3: toolSpawn,
+		ebiten.Key4: toolItemSpawner,
+		ebiten.Key5: toolErase,
+	} {
+		if inpututil.IsKeyJustPressed(key) {
+			e.tool = tool
+		}
+	}
+
+	for key, d := range map[ebiten.Key]Position{
+		ebiten.KeyArrowLeft:  {X: -1},
+		ebiten.KeyArrowRight: {X: 1},
+		ebiten.KeyArrowUp:    {Y: -1},
+		ebiten.KeyArrowDown:  {Y: 1},
+	} {
+		if inpututil.IsKeyJustPressed(key) {
+			e.camera.x = clampView(e.camera.x+float64(d.X*gridSize), e.size.width*gridSize, viewWidth)
+			e.camera.y = clampView(e.camera.y+float64(d.Y*gridSize), e.size.height*gridSize, viewHeight)
+		}
+	}
+
+	x, y := ebiten.CursorPosition()
+	pos := Position{X: (x + int(e.camera.x)) / gridSize, Y: (y + int(e.camera.y)) / gridSize}
+	if y < viewHeight && e.size.validCoordinate(pos) {
+		if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+			if e.tool == toolErase {
+				delete(e.cells, pos)
+			} else {
+				e.cells[pos] = e.tool
+			}
+		} else if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
+			delete(e.cells, pos)
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		if err := e.save(); err != nil {
+			e.status = err.Error()
+		} else {
+			e.status = "saved to " + e.path()
+		}
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyP) && e.publishCh == nil {
+		if err := e.publish(); err != nil {
+			e.status = err.Error()
+		} else {
+			e.status = "publishing to room " + e.roomName
+		}
+	}
+	select {
+	case status := <-e.publishCh:
+		e.status = status
+		e.publishCh = nil
+	default:
+	}
+	return nil
+}
+
+func (e *Editor) Draw(screen *ebiten.Image) {
+	view := screen.SubImage(image.Rect(0, 0, viewWidth, viewHeight)).(*ebiten.Image)
+	// the area outside the map
+	w, h := e.camera.screenXY(Position{X: e.size.width, Y: e.size.height})
+	ebitenutil.DrawRect(view, w, 0, viewWidth, viewHeight, outsideMapColor)
+	ebitenutil.DrawRect(view, 0, h, viewWidth, viewHeight, outsideMapColor)
+
+	for pos, tool := range e.cells {
+		var c color.Color
+		switch tool {
+		case toolWall:
+			c = indestructibleObstacleColor
+		case toolBlock:
+			c = destructibleObstacleColor
+		case toolSpawn:
+			c = spawnColor
+		case toolItemSpawner:
+			c = itemSpawnerColor
+		}
+		x, y := e.camera.screenXY(pos)
+		ebitenutil.DrawRect(view, x, y, gridSize, gridSize, c)
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("[%s] %s", toolNames[e.tool], e.status),
+		0, screenHeight-scoreBarHeight+10)
+}
+
+func (e *Editor) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return screenWidth, screenHeight
+}
+
+// gameMap build and validate the painted map
+func (e *Editor) gameMap() (*GameMap, error) {
+	m := &GameMap{
+		Name:   e.name,
+		Width:  e.size.width,
+		Height: e.size.height,
+	}
+	for pos, tool := range e.cells {
+		switch tool {
+		case toolWall:
+			m.Walls = append(m.Walls, pos)
+		case toolBlock:
+			m.Blocks = append(m.Blocks, pos)
+		case toolSpawn:
+			m.Spawns = append(m.Spawns, pos)
+		case toolItemSpawner:
+			m.ItemSpawners = append(m.ItemSpawners, pos)
+		}
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (e *Editor) path() string {
+	return filepath.Join(mapDir, e.name+".txt")
+}
+
+func (e *Editor) save() error {
+	m, err := e.gameMap()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(mapDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(e.path(), []byte(m.text()), 0644)
+}
+
+// publish send the map to the room in the background, connecting to pulsar takes a while
+func (e *Editor) publish() error {
+	m, err := e.gameMap()
+	if err != nil {
+		return err
+	}
+	e.publishCh = make(chan string, 1)
+	go func(publishCh chan string) {
+		if err := publishMap(e.roomName, m, e.connection); err != nil {
+			publishCh <- err.Error()
+			return
+		}
+		publishCh <- "published to room " + e.roomName
+	}(e.publishCh)
+	return nil
+}
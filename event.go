@@ -1,8 +1,8 @@
 package main
 
 import (
+	"fmt"
 	log "github.com/sirupsen/logrus"
-	"strings"
 	"time"
 )
 
@@ -16,6 +16,8 @@ const (
 	ExplodeEventType      = "ExplodeEvent"
 	UndoExplodeEventType  = "UndoExplodeEvent"
 	InitObstacleEventType = "UpdateMapEvent"
+	ChatEventType         = "ChatEvent"
+	InputEventType        = "InputEvent"
 )
 
 // Event make change on Graph
@@ -30,7 +32,7 @@ type UserMoveEvent struct {
 
 func (a *UserMoveEvent) handle(g *Game) {
 	log.Info("handle UserMoveEvent")
-	if !validCoordinate(a.pos) {
+	if !g.size.validCoordinate(a.pos) {
 		// move out of boarder
 		return
 	}
@@ -48,13 +50,39 @@ func (a *UserMoveEvent) handle(g *Game) {
 
 type UserDeadEvent struct {
 	*playerInfo
+	// the player who set the bomb
 	killer string
+	// the player who pushed the bomb last, empty if it was not pushed
+	pusher string
 }
 
 func (e *UserDeadEvent) handle(game *Game) {
 	if _, ok := game.nameToPlayers[e.name]; ok {
 		game.nameToPlayers[e.name].alive = false
 	}
+	if lp := game.localPlayer(e.name); lp != nil && game.remote {
+		// the server decided the death, the bomb is still burning
+		game.flameLock.RLock()
+		if bomb := game.flameMap[e.pos]; bomb != nil {
+			lp.recap = newDeathRecap(bomb)
+		}
+		game.flameLock.RUnlock()
+	}
+	game.addKill(e.killer, e.pusher, e.name)
+	game.recordDeath(e.name, e.killer, e.pusher)
+	switch e.killer {
+	case "":
+		game.chat.system("%s died", e.name)
+	case e.name:
+		game.chat.system("%s blew themselves up", e.name)
+	case "random":
+		game.chat.system("%s was killed by a random bomb", e.name)
+	default:
+		game.chat.system("%s killed %s", e.killer, e.name)
+	}
+	if e.pusher != "" && e.pusher != e.killer {
+		game.chat.system("%s pushed the bomb", e.pusher)
+	}
 }
 
 type UserReviveEvent struct {
@@ -71,8 +99,10 @@ type UserJoinEvent struct {
 }
 
 func (e *UserJoinEvent) handle(game *Game) {
-	//TODO implement me
-	panic("implement me")
+	if _, ok := game.nameToPlayers[e.name]; !ok {
+		game.nameToPlayers[e.name] = e.playerInfo
+	}
+	game.chat.system("%s joined", e.name)
 }
 
 type SetBombEvent struct {
@@ -87,17 +117,14 @@ func (e *SetBombEvent) handle(game *Game) {
 		return
 	}
 	bombName := game.setBombWithTrigger(e.bombName, e.pos, make(chan struct{}))
-	if strings.HasPrefix(bombName, "random-") ||
-		strings.HasPrefix(bombName, game.localPlayerName+"-") {
-		// send explode message
-		go func() {
-			// bomb will explode after 2 seconds
-			bombTimer := time.NewTimer(explodeTime * time.Second)
-			<-bombTimer.C
+	game.stats(game.nameToBombs[bombName].playerName).bombs++
+	if game.ownsBomb(bombName) {
+		// send explode message, bomb will explode after 2 seconds
+		game.clock.AfterFunc(explodeTime*time.Second, func() {
 			game.sendAsync(&ExplodeEvent{
 				bombName: bombName,
 			})
-		}()
+		})
 	}
 }
 
@@ -113,38 +140,37 @@ func (e *ExplodeEvent) handle(game *Game) {
 		// bombs are set to the same place will cause this situation
 		return
 	}
-	// async notify, if this bomb is moving, it will stop moving
-	select {
-	case bomb.explodeCh <- struct{}{}:
-	default:
-	}
+	// if this bomb is moving, it will stop moving
+	bomb.stop()
 	game.explode(bomb)
 
-	if strings.HasPrefix(bomb.bombName, "random-") ||
-		strings.HasPrefix(bomb.bombName, game.localPlayerName+"-") {
-		go func() {
-			// explosion flame will disappear after 2 seconds
-			flameTimer := time.NewTimer(flameTime * time.Second)
-			<-flameTimer.C
+	if game.ownsBomb(bomb.bombName) {
+		// explosion flame will disappear after 2 seconds
+		game.clock.AfterFunc(flameTime*time.Second, func() {
 			game.sendAsync(&UndoExplodeEvent{
-				pos: bomb.pos,
+				bombName: bomb.bombName,
+				pos:      bomb.pos,
 			})
-		}()
+		})
 	}
 }
 
+// UndoExplodeEvent put out the flames of a bomb, only its owner sends it
 type UndoExplodeEvent struct {
-	pos Position
+	bombName string
+	pos      Position
 }
 
 func (e *UndoExplodeEvent) handle(game *Game) {
-	game.unExplode(e.pos)
+	game.unExplode(e.bombName, e.pos)
 }
 
 type BombMoveEvent struct {
 	// bomb playerName, generate by player info
 	bombName string
 	pos      Position
+	// the player who pushed the bomb
+	pusher string
 }
 
 func (e *BombMoveEvent) handle(game *Game) {
@@ -159,36 +185,90 @@ func (e *BombMoveEvent) handle(game *Game) {
 	}
 	// move this bomb
 	delete(game.posToBombs, bomb.pos)
+	if bomb.lastPusher() != e.pusher {
+		// a push moves the bomb several grids
+		bomb.pushers = append(bomb.pushers, e.pusher)
+	}
 	bomb.pos = e.pos
 	game.posToBombs[e.pos] = bomb
 }
 
 type UpdateMapEvent struct {
 	Obstacles []int
+	// the hand-designed map, nil for random obstacles
+	gameMap *GameMap
+	// the rules of the room, nil when they don't change
+	rules *roomRules
+}
+
+// roomRules are decided by the client publishing the maps of a room, they are sent with its maps
+type roomRules struct {
+	// cells per second of the players, at most
+	Speed float64 `json:"speed"`
+	// how every client and the scorer score the deaths, nil for old clients
+	Scoring *scoreRules `json:"scoring,omitempty"`
+}
+
+// maxPoints of a death for a player
+const maxPoints = 100
+
+func (r *roomRules) validate() error {
+	if r.Speed <= 0 || r.Speed > maxSpeed {
+		return fmt.Errorf("invalid speed %v", r.Speed)
+	}
+	if s := r.Scoring; s != nil {
+		for _, p := range []int{s.Kill, s.Assist, s.Suicide} {
+			if p < -maxPoints || p > maxPoints {
+				return fmt.Errorf("invalid points %d", p)
+			}
+		}
+	}
+	return nil
 }
 
 func (e *UpdateMapEvent) handle(game *Game) {
-	obstacleMap := map[Position]ObstacleType{}
-	for _, code := range e.Obstacles {
-		destructible := false
-		if code < 0 {
-			// this is a destructible obstacle
-			destructible = true
-			code = -code
+	// maps without gameMap are sent by old clients, they fill one screen
+	size := defaultMapSize
+	if e.rules != nil {
+		game.setRoomSpeed(e.rules.Speed)
+		if e.rules.Scoring != nil {
+			game.roomScoring = e.rules.Scoring
 		}
-		x, y := decodeXY(code)
-		pos := Position{
-			X: x,
-			Y: y,
+	}
+	if e.gameMap != nil {
+		size = e.gameMap.size()
+		// players revive at the spawns of the map they know
+		game.validation.previousMap = game.gameMap
+		game.gameMap = e.gameMap
+		for _, name := range game.controlledNames() {
+			if game.spawned[name] || game.remote {
+				// the server spawns the players of remote clients
+				continue
+			}
+			// first map received, go to a spawn point
+			game.spawned[name] = true
+			localPlayer := game.nameToPlayers[name]
+			game.sendAsync(&UserMoveEvent{
+				playerInfo: &playerInfo{
+					name:   localPlayer.name,
+					avatar: localPlayer.avatar,
+					pos:    game.randomSpawn(),
+					alive:  localPlayer.alive,
+				},
+			})
 		}
+	}
+	obstacleMap := map[Position]ObstacleType{}
+	for _, code := range e.Obstacles {
+		pos, t := decodeObstacle(size, code)
 		if game.posToBombs[pos] != nil || game.posToPlayers[pos] != nil {
 			continue
 		}
-		if destructible {
-			obstacleMap[pos] = destructibleObstacleType
-		} else {
-			obstacleMap[pos] = indestructibleObstacleType
-		}
+		obstacleMap[pos] = t
 	}
+	game.obstacleLock.Lock()
 	game.obstacleMap = obstacleMap
+	game.obstacleVersion++
+	game.size = size
+	game.obstacleLock.Unlock()
 }
@@ -2,16 +2,11 @@ package main
 
 import (
 	"bytes"
-	"fmt"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/audio/wav"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	raudio "github.com/hajimehoshi/ebiten/v2/examples/resources/audio"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
-	lru "github.com/hashicorp/golang-lru"
 	log "github.com/sirupsen/logrus"
-	"image/color"
 	"math/rand"
 	"strings"
 	"sync"
@@ -31,9 +26,10 @@ const (
 	totalGridCount     = xGridCountInScreen * yGridCountInScreen
 
 	bombLength = 8
-	// there are indestructibleObstacleCount obstacles in map
-	indestructibleObstacleCount = totalGridCount / 5
-	destructibleObstacleCount   = totalGridCount / 4
+	// one of every indestructibleObstacleRatio cells is an indestructible obstacle
+	indestructibleObstacleRatio = 5
+	// one of every destructibleObstacleRatio free cells is a destructible obstacle
+	destructibleObstacleRatio = 4
 	// bomb explode after explodeTime second
 	explodeTime = 2
 	// flame disappear after flameTime second
@@ -52,13 +48,28 @@ const (
 )
 
 type Game struct {
-	// scores of every player
-	scores *lru.Cache
-
-	// local player playerName
-	localPlayerName string
-	nameToPlayers   map[string]*playerInfo
-	posToPlayers    map[Position]*playerInfo
+	// scores of every player from the score topic,
+	// written by the table view listener
+	scoreLock sync.RWMutex
+	scores    map[string]string
+	// stats of every player counted from the events
+	playerStats map[string]*playerStats
+	// whether a local player holds the scoreboard key
+	showScoreboard bool
+	// whether a local player holds the leaderboard key
+	showLeaderboard bool
+	// to check the events of the other clients
+	validation validation
+
+	// players playing on this client
+	localPlayers []*localPlayer
+	bots         []*bot
+	// players controlled through the gym api
+	agents []*agent
+	// whether the players of this client have been moved to a spawn point
+	spawned       map[string]bool
+	nameToPlayers map[string]*playerInfo
+	posToPlayers  map[Position]*playerInfo
 
 	nameToBombs map[string]*Bomb
 	posToBombs  map[Position]*Bomb
@@ -72,11 +83,45 @@ type Game struct {
 	obstacleLock sync.RWMutex
 	// two types of obstacle
 	obstacleMap map[Position]ObstacleType
+	// increase when obstacleMap changes, then the renderer redraws obstacles
+	obstacleVersion int
+	// when destructible obstacles are destroyed, for the crumbling animation
+	crumbling map[Position]time.Time
+	// the current map, nil before any map is received
+	gameMap *GameMap
+	// size of the current map, timers read it under obstacleLock
+	size     mapSize
+	config   *config
+	renderer renderer
+	// messages of the room and the chat input box
+	chat chat
+	// recent deaths
+	killFeed []kill
 
 	// audio player
 	audioContext *audio.Context
 	deadPlayer   *audio.Player
 
+	// time of the game, the wall clock except in simulations
+	clock clock
+	rng   *rand.Rand
+	// dead players can't revive, for tournament matches
+	elimination bool
+
+	// this game is the authoritative server of the room,
+	// it plays every player from their inputs
+	server bool
+	// cells per second of the players of the server
+	speed float64
+	// the speed of the room from the rules of its maps, 0 before any rules
+	roomSpeed float64
+	// the scoring of the room from the rules of its maps, nil before any
+	roomScoring *scoreRules
+	// the room has a server, this client only sends the inputs of its players and renders
+	remote bool
+	// the last input sent of every player of a remote client
+	sentInputs map[string]intent
+
 	// receive event to redraw our game
 	eventCh chan Event
 	// send local event to send to pulsar
@@ -91,6 +136,19 @@ func (g *Game) Close() {
 	close(g.eventCh)
 }
 
+// drainEvents handle all received events, simulations call it every tick
+// because Update handles one event at most
+func (g *Game) drainEvents() {
+	for {
+		select {
+		case event := <-g.eventCh:
+			event.handle(g)
+		default:
+			return
+		}
+	}
+}
+
 func (g *Game) Update() error {
 	// listen to event
 	select {
@@ -99,115 +157,102 @@ func (g *Game) Update() error {
 	default:
 	}
 
-	localPlayer := g.nameToPlayers[g.localPlayerName]
-
-	info := &playerInfo{
-		name:   localPlayer.name,
-		pos:    localPlayer.pos,
-		avatar: localPlayer.avatar,
-		alive:  localPlayer.alive,
-	}
-
-	var dir = dirNone
-	var bomb = false
-	if inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft) || inpututil.IsKeyJustPressed(ebiten.KeyA) {
-		dir = dirLeft
-	} else if inpututil.IsKeyJustPressed(ebiten.KeyArrowRight) || inpututil.IsKeyJustPressed(ebiten.KeyD) {
-		dir = dirRight
-	} else if inpututil.IsKeyJustPressed(ebiten.KeyArrowDown) || inpututil.IsKeyJustPressed(ebiten.KeyS) {
-		dir = dirDown
-	} else if inpututil.IsKeyJustPressed(ebiten.KeyArrowUp) || inpututil.IsKeyJustPressed(ebiten.KeyW) {
-		dir = dirUp
-	} else if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
-		bomb = true
-	} else if inpututil.IsKeyJustPressed(ebiten.KeyR) {
-		// revive
-		event := &UserReviveEvent{
-			playerInfo: info,
+	typing := g.updateChat()
+	g.showScoreboard = false
+	g.showLeaderboard = false
+	for _, lp := range g.localPlayers {
+		g.updateLocalPlayer(lp, typing)
+		if !typing && lp.controls.pressed(actionScoreboard) {
+			g.showScoreboard = true
 		}
-		g.sendAsync(event)
-	} else if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
-		// quit game
-	}
-
-	g.flameLock.RLock()
-	if val, ok := g.flameMap[localPlayer.pos]; ok && val != nil && localPlayer.alive {
-		localPlayer.alive = false
-		// dead due to boom
-		event := &UserDeadEvent{
-			playerInfo: info,
-			// the player who set the bomb
-			killer: val.playerName,
+		if !typing && lp.controls.pressed(actionLeaderboard) {
+			g.showLeaderboard = true
 		}
-		g.sendAsync(event)
 	}
-	g.flameLock.RUnlock()
+	for _, b := range g.bots {
+		g.updateBot(b)
+	}
+	for _, a := range g.agents {
+		g.act(a.name, a.mover, a.next)
+		// the direction is held until the next action, the other actions are done once
+		a.next.pressed, a.next.bomb, a.next.detonate, a.next.revive = dirNone, false, false, false
+	}
+
+	return nil
+}
 
-	if dir != dirNone && localPlayer.alive {
-		nextPlayerPos := getNextPosition(localPlayer.pos, dir)
-		info.pos = nextPlayerPos
-		event := &UserMoveEvent{
-			playerInfo: info,
+// pushBomb move the bomb in direction until it hits something, a grid every bombMoveDuration
+func (g *Game) pushBomb(bomb *Bomb, direction Direction, pusher string) {
+	g.obstacleLock.RLock()
+	nextPos := g.size.getNextPosition(bomb.pos, direction)
+	g.obstacleLock.RUnlock()
+	var step func(i int)
+	step = func(i int) {
+		select {
+		case <-bomb.explodeCh:
+			// bomb exploded, stop
+			return
+		default:
 		}
-		g.sendAsync(event)
-		if bomb, ok := g.posToBombs[nextPlayerPos]; ok {
-			// push the bomb
-			go func(bomb *Bomb, direction Direction) {
-				nextPos := getNextPosition(bomb.pos, direction)
-				ticker := time.NewTicker(time.Second / 2)
-				defer ticker.Stop()
-				for i := 0; i < 8; i++ {
-					select {
-					case <-bomb.explodeCh:
-						// bomb exploded, stop
-						return
-					case <-ticker.C:
-						g.obstacleLock.RLock()
-						if _, ok = g.obstacleMap[nextPos]; !validCoordinate(nextPos) || ok {
-							// move to border or obstacle, stop
-							g.obstacleLock.RUnlock()
-							return
-						}
-						g.obstacleLock.RUnlock()
-
-						event := &BombMoveEvent{
-							bombName: bomb.bombName,
-							pos:      nextPos,
-						}
-						g.sendAsync(event)
-						nextPos = getNextPosition(nextPos, direction)
-					}
-				}
-			}(bomb, dir)
+		g.obstacleLock.RLock()
+		if _, ok := g.obstacleMap[nextPos]; !g.size.validCoordinate(nextPos) || ok {
+			// move to border or obstacle, stop
+			g.obstacleLock.RUnlock()
+			return
 		}
-	}
-
-	// set bomb on empty block
-	if _, ok := g.posToBombs[localPlayer.pos]; !ok && bomb {
-		info.pos = localPlayer.pos
-		event := &SetBombEvent{
-			bombName: info.name + "-" + randStringRunes(5),
-			pos:      info.pos,
+		event := &BombMoveEvent{
+			bombName: bomb.bombName,
+			pos:      nextPos,
+			pusher:   pusher,
 		}
+		nextPos = g.size.getNextPosition(nextPos, direction)
+		g.obstacleLock.RUnlock()
+
 		g.sendAsync(event)
+		if i+1 < 8 {
+			g.clock.AfterFunc(bombMoveDuration, func() { step(i + 1) })
+		}
 	}
-
-	return nil
+	g.clock.AfterFunc(bombMoveDuration, func() { step(0) })
 }
 
 // setBomb create a bomb with trigger channel
 func (g *Game) setBombWithTrigger(bombName string, position Position, trigger chan struct{}) string {
 	bomb := &Bomb{
 		bombName:   bombName,
-		playerName: strings.Split(bombName, "-")[0],
+		playerName: bombOwner(bombName),
 		pos:        position,
 		explodeCh:  trigger,
+		setTime:    g.clock.Now(),
 	}
 	g.nameToBombs[bomb.bombName] = bomb
 	g.posToBombs[bomb.pos] = bomb
 	return bomb.bombName
 }
 
+// bombOwner is the player a bomb is named after
+func bombOwner(bombName string) string {
+	return strings.SplitN(bombName, "-", 2)[0]
+}
+
+// detonate explode the oldest bomb of the player now
+func (g *Game) detonate(playerName string) {
+	var oldest *Bomb
+	for _, bomb := range g.nameToBombs {
+		if bomb.playerName != playerName {
+			continue
+		}
+		if oldest == nil || bomb.setTime.Before(oldest.setTime) {
+			oldest = bomb
+		}
+	}
+	if oldest != nil {
+		g.sendAsync(&ExplodeEvent{
+			bombName: oldest.bombName,
+		})
+	}
+}
+
 func (g *Game) removeBomb(bombName string) {
 	if bomb, ok := g.nameToBombs[bombName]; ok {
 		delete(g.nameToBombs, bombName)
@@ -217,7 +262,21 @@ func (g *Game) removeBomb(bombName string) {
 	}
 }
 
+// randomSpawn pick a spawn point of current map
+func (g *Game) randomSpawn() Position {
+	if g.gameMap == nil || len(g.gameMap.Spawns) == 0 {
+		return Position{}
+	}
+	return g.gameMap.Spawns[g.rng.Intn(len(g.gameMap.Spawns))]
+}
+
+// sendAsync queue event to be sent, a client drops it when the queue is full.
+// The server never drops its events, they are the state of the room, it waits for the queue.
 func (g *Game) sendAsync(event Event) {
+	if g.server {
+		g.sendCh <- event
+		return
+	}
 	// don't block
 	select {
 	case g.sendCh <- event:
@@ -226,56 +285,7 @@ func (g *Game) sendAsync(event Event) {
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	// todo replace Rect with images
-
-	for pos, _ := range g.posToBombs {
-		ebitenutil.DrawRect(screen, float64(pos.X*gridSize), float64(pos.Y*gridSize), gridSize, gridSize, bombColor)
-	}
-
-	for pos, t := range g.obstacleMap {
-		if t == destructibleObstacleType {
-			ebitenutil.DrawRect(screen, float64(pos.X*gridSize), float64(pos.Y*gridSize), gridSize, gridSize, destructibleObstacleColor)
-		} else {
-			ebitenutil.DrawRect(screen, float64(pos.X*gridSize), float64(pos.Y*gridSize), gridSize, gridSize, indestructibleObstacleColor)
-		}
-	}
-
-	for _, player := range g.nameToPlayers {
-		var userColor color.RGBA
-		if player.alive {
-			userColor = playerColor
-		} else {
-			userColor = deadPlayerColor
-		}
-		ebitenutil.DrawRect(screen, float64(player.pos.X*gridSize), float64(player.pos.Y*gridSize), gridSize, gridSize, userColor)
-	}
-
-	if !g.nameToPlayers[g.localPlayerName].alive {
-		ebitenutil.DebugPrint(screen, fmt.Sprintf("You are dead, press R to revive."))
-	}
-
-	scoreStr := strings.Builder{}
-	scoreStr.WriteString("scores: ")
-	for _, k := range g.scores.Keys() {
-		score, ok := g.scores.Get(k)
-		if !ok {
-			continue
-		}
-		scoreStr.WriteString(k.(string))
-		scoreStr.WriteString(" = ")
-		scoreStr.WriteString(score.(string) + "; ")
-	}
-	// print the score of all players
-	ebitenutil.DebugPrintAt(screen, scoreStr.String(), 0, screenHeight-scoreBarHeight+10)
-
-	g.flameLock.RLock()
-	for pos, val := range g.flameMap {
-		// only val > 0 means flame
-		if val != nil {
-			ebitenutil.DrawRect(screen, float64(pos.X*gridSize), float64(pos.Y*gridSize), gridSize, gridSize, flameColor)
-		}
-	}
-	g.flameLock.RUnlock()
+	g.renderer.draw(g, screen)
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
@@ -291,7 +301,44 @@ func (g *Game) explode(bomb *Bomb) {
 	g.removeBomb(bomb.bombName)
 
 	// calculate flames
+	positions := g.flamePositions(pos)
+
+	g.flameLock.Lock()
+	g.obstacleLock.Lock()
+	defer g.flameLock.Unlock()
+	defer g.obstacleLock.Unlock()
+	now := g.clock.Now()
+	for position, t := range g.crumbling {
+		if now.Sub(t) > crumbleDuration {
+			delete(g.crumbling, position)
+		}
+	}
+	for _, position := range positions {
+		if !g.size.validCoordinate(position) {
+			continue
+		}
+		// set value to the bomb pointer
+		g.flameMap[position] = bomb
+		if t, ok := g.obstacleMap[position]; ok && t == destructibleObstacleType {
+			g.stats(bomb.playerName).blocks++
+			delete(g.obstacleMap, position)
+			g.obstacleVersion++
+			g.crumbling[position] = now
+		}
+		// if a player standing there, dead
+		// todo
+		//if player, ok := g.posToPlayers[position]; ok {
+		//	player.alive = false
+		//}
+	}
+
+}
+
+// flamePositions are the grids a bomb at pos burns, flames pass destructible obstacles
+// and stop at indestructible ones. Positions may be outside the map.
+func (g *Game) flamePositions(pos Position) []Position {
 	g.obstacleLock.RLock()
+	defer g.obstacleLock.RUnlock()
 	var positions []Position
 	for i := pos.X - 1; i >= pos.X-bombLength; i-- {
 		p := Position{X: i, Y: pos.Y}
@@ -321,31 +368,11 @@ func (g *Game) explode(bomb *Bomb) {
 		}
 		positions = append(positions, p)
 	}
-	g.obstacleLock.RUnlock()
-
-	g.flameLock.Lock()
-	g.obstacleLock.Lock()
-	defer g.flameLock.Unlock()
-	defer g.obstacleLock.Unlock()
-	for _, position := range positions {
-		if !validCoordinate(position) {
-			continue
-		}
-		// set value to the bomb pointer
-		g.flameMap[position] = bomb
-		if t, ok := g.obstacleMap[position]; ok && t == destructibleObstacleType {
-			delete(g.obstacleMap, position)
-		}
-		// if a player standing there, dead
-		// todo
-		//if player, ok := g.posToPlayers[position]; ok {
-		//	player.alive = false
-		//}
-	}
-
+	return positions
 }
 
-func (g *Game) unExplode(pos Position) {
+// unExplode put out the flames of the bomb which exploded at pos, the flames of other bombs stay
+func (g *Game) unExplode(bombName string, pos Position) {
 	var positions []Position
 	for i := pos.X - bombLength; i < pos.X+bombLength+1; i++ {
 		positions = append(positions, Position{X: i, Y: pos.Y})
@@ -355,18 +382,11 @@ func (g *Game) unExplode(pos Position) {
 	}
 	g.flameLock.Lock()
 	defer g.flameLock.Unlock()
-	bomb := g.flameMap[pos]
 	for _, position := range positions {
-		if !validCoordinate(position) {
+		if !g.size.validCoordinate(position) {
 			continue
 		}
-		//if val, ok := g.flameMap[position]; !ok || val <= 0 {
-		//	// the unexplode event only has position info,
-		//	// so history event may trigger unexplode event unexpectedly,
-		//	// so we ensure all grids is flame, then trigger this event
-		//	return
-		//}
-		if _, ok := g.flameMap[position]; bomb == nil || (ok) {
+		if bomb := g.flameMap[position]; bomb != nil && bomb.bombName == bombName {
 			g.flameMap[position] = nil
 		}
 	}
@@ -380,11 +400,14 @@ func (g *Game) randomBombsEnable() {
 		for {
 			select {
 			case <-ticker.C:
+				g.obstacleLock.RLock()
 				randomPos := Position{
-					X: rand.Intn(xGridCountInScreen),
-					Y: rand.Intn(yGridCountInScreen),
+					X: rand.Intn(g.size.width),
+					Y: rand.Intn(g.size.height),
 				}
-				if _, ok := g.obstacleMap[randomPos]; ok {
+				_, ok := g.obstacleMap[randomPos]
+				g.obstacleLock.RUnlock()
+				if ok {
 					continue
 				}
 				if _, ok := g.posToBombs[randomPos]; ok {
@@ -399,56 +422,192 @@ func (g *Game) randomBombsEnable() {
 	}()
 }
 
-// playerName will be the subscription name
-// roomName will be the topic name
-func newGame(playerName, roomName string) *Game {
-	info := &playerInfo{
-		name:   playerName,
-		avatar: "fff",
-		pos: Position{
-			X: 0,
-			Y: 0,
-		},
-		alive: true,
+// roomOptions decide how to reach a room and its map
+type roomOptions struct {
+	// the connection to pulsar
+	connection connectionConfig
+	// mapName selects a map in mapDir, empty for generated obstacles
+	mapName string
+	// generator and seed of generated obstacles, seed 0 means random
+	generator string
+	seed      int64
+	// size of generated maps
+	size mapSize
+	// cells per second of the players, this client publishes it with its maps
+	speed float64
+	// how deaths are scored, this client publishes it with its maps
+	scoring scoreRules
+}
+
+// playerOptions describe a local player or a bot
+type playerOptions struct {
+	// name will be the subscription name
+	name string
+	// avatar selects the skin of the player
+	avatar string
+	// speed is how many cells per second the player moves
+	speed float64
+	// bot is the difficulty of a bot, empty for a human player
+	bot string
+	// agent players are controlled through the gym api
+	agent bool
+}
+
+// roomName will be the topic name, the first player names the subscriptions,
+// with remote the players are played by the server of the room
+func newGame(players []playerOptions, roomName string, options roomOptions, cfg *config, remote bool) *Game {
+	client := newRoomClient(roomName, players[0].name, options)
+	g := newGameState(cfg, realClock{}, time.Now().UnixNano())
+	g.client = client
+	g.remote = remote
+	client.remote = remote
+	if remote {
+		client.produceInputs()
 	}
-	client := newPulsarClient(roomName, playerName)
-	cache, err := lru.New(5)
-	g := &Game{
-		scores:          cache,
-		localPlayerName: playerName,
-		nameToPlayers:   map[string]*playerInfo{},
-		posToPlayers:    map[Position]*playerInfo{},
-		nameToBombs:     map[string]*Bomb{},
-		posToBombs:      map[Position]*Bomb{},
-		flameMap:        map[Position]*Bomb{},
-		eventCh:         nil,
-		sendCh:          nil,
-		client:          client,
+	for _, player := range players[1:] {
+		// every player signs its own messages
+		if err := client.publishKey(player.name); err != nil {
+			log.Fatal("[newGame]", err)
+		}
+		if err := client.guardName(player.name); err != nil {
+			log.Fatal("[newGame] ", player.name, " has logged in")
+		}
 	}
 
 	// pulsar tableview update scores of every player
 	client.tableView.ForEachAndListen(func(playerName string, i interface{}) error {
 		score := *i.(*string)
-		g.scores.Add(playerName, score)
+		g.scoreLock.Lock()
+		g.scores[playerName] = score
+		g.scoreLock.Unlock()
 		return nil
 	})
 
-	// init audio player
-	jabD, err := wav.DecodeWithoutResampling(bytes.NewReader(raudio.Jab_wav))
-	g.audioContext = audio.NewContext(48000)
-	g.deadPlayer, err = g.audioContext.NewPlayer(jabD)
-	if err != nil {
-		log.Fatal(err)
+	g.addPlayers(players)
+	if len(g.localPlayers) > 0 {
+		// init audio player, headless bots have no sound
+		jabD, err := wav.DecodeWithoutResampling(bytes.NewReader(raudio.Jab_wav))
+		g.audioContext = audio.NewContext(48000)
+		g.deadPlayer, err = g.audioContext.NewPlayer(jabD)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	// init local player
-	g.nameToPlayers[info.name] = info
-	g.posToPlayers[info.pos] = info
-
 	// use this channel to send to pulsar
 	g.sendCh = make(chan Event, 20)
 	// use this channel to receive from pulsar
 	g.eventCh = g.client.start(g.sendCh)
+	// one client of the room scores the deaths
+	go client.runScorer(cfg.Scoring)
 
+	g.join()
 	return g
 }
+
+// newRoomClient connect to the topics of a room, the map of the room is chosen by options
+func newRoomClient(roomName, playerName string, options roomOptions) *pulsarClient {
+	client := newPulsarClient(roomName, playerName, options.connection)
+	client.generator = options.generator
+	client.seed = options.seed
+	client.size = options.size
+	client.rules = roomRules{Speed: clampSpeed(options.speed), Scoring: &options.scoring}
+	if options.mapName != "" {
+		gameMap, err := loadMapByName(options.mapName)
+		if err != nil {
+			log.Fatal("[newRoomClient]", err)
+		}
+		client.gameMap = gameMap
+	}
+	return client
+}
+
+// simEventQueueSize is the capacity of the event bus of simulations
+const simEventQueueSize = 1024
+
+// newSimGame create a game of bots without pulsar, the events loop back in process,
+// and the game moves with clk. Call drainEvents and Update every tick.
+func newSimGame(players []playerOptions, cfg *config, clk clock, seed int64) *Game {
+	g := newGameState(cfg, clk, seed)
+	g.addPlayers(players)
+	g.sendCh = make(chan Event, simEventQueueSize)
+	g.eventCh = g.sendCh
+	g.join()
+	return g
+}
+
+// newGameState create a game without players and event channels
+func newGameState(cfg *config, clk clock, seed int64) *Game {
+	return &Game{
+		scores:        map[string]string{},
+		playerStats:   map[string]*playerStats{},
+		size:          defaultMapSize,
+		config:        cfg,
+		spawned:       map[string]bool{},
+		nameToPlayers: map[string]*playerInfo{},
+		posToPlayers:  map[Position]*playerInfo{},
+		nameToBombs:   map[string]*Bomb{},
+		posToBombs:    map[Position]*Bomb{},
+		flameMap:      map[Position]*Bomb{},
+		crumbling:     map[Position]time.Time{},
+		sentInputs:    map[string]intent{},
+		validation:    newValidation(),
+		clock:         clk,
+		rng:           rand.New(rand.NewSource(seed)),
+	}
+}
+
+// addPlayers init the local players and the bots, local players share the view
+func (g *Game) addPlayers(players []playerOptions) {
+	humans := 0
+	for _, player := range players {
+		if player.bot == "" && !player.agent {
+			humans++
+		}
+	}
+	rects := viewports(humans)
+	for _, player := range players {
+		info := &playerInfo{
+			name:   player.name,
+			avatar: player.avatar,
+			pos: Position{
+				X: 0,
+				Y: 0,
+			},
+			alive: true,
+		}
+		g.nameToPlayers[info.name] = info
+		g.posToPlayers[info.pos] = info
+		if player.bot != "" {
+			g.bots = append(g.bots, newBot(player.name, difficulties[player.bot], g.rng.Int63()))
+			continue
+		}
+		if player.agent {
+			g.agents = append(g.agents, &agent{name: player.name, mover: newMover(player.speed)})
+			continue
+		}
+		i := len(g.localPlayers)
+		g.localPlayers = append(g.localPlayers, &localPlayer{
+			name:     player.name,
+			index:    i,
+			mover:    newMover(player.speed),
+			controls: newControls(g.config, i),
+			camera:   newCamera(rects[i]),
+		})
+	}
+}
+
+// join announce the players of this client to the room,
+// the server of the room announces the players of remote clients
+func (g *Game) join() {
+	for _, name := range g.controlledNames() {
+		if g.remote {
+			g.sendInput(name, intent{})
+			continue
+		}
+		info := *g.nameToPlayers[name]
+		g.sendAsync(&UserJoinEvent{
+			playerInfo: &info,
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mapDir is where rooms look up maps by name
+const mapDir = "maps"
+
+// maxMapLength limits the width and height of a map
+const maxMapLength = 200
+
+// characters of the text grid map format
+const (
+	mapEmptyChar       = '.'
+	mapWallChar        = '#'
+	mapBlockChar       = '*'
+	mapSpawnChar       = 'S'
+	mapItemSpawnerChar = 'I'
+	mapCommentPrefix   = ";"
+)
+
+// GameMap describes an arena, it can be loaded from a text grid or a json file
+type GameMap struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// indestructible obstacles
+	Walls []Position `json:"walls"`
+	// destructible obstacles
+	Blocks       []Position `json:"blocks"`
+	Spawns       []Position `json:"spawns"`
+	ItemSpawners []Position `json:"itemSpawners"`
+	// generator and seed of a generated map, empty for hand-designed maps
+	Generator string `json:"generator,omitempty"`
+	Seed      int64  `json:"seed,omitempty"`
+}
+
+// loadMapByName find the map file in mapDir, text grid first, then json
+func loadMapByName(name string) (*GameMap, error) {
+	for _, ext := range []string{".txt", ".json"} {
+		path := filepath.Join(mapDir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return loadMap(path)
+		}
+	}
+	return nil, fmt.Errorf("map %q not found in %s", name, mapDir)
+}
+
+// loadMap read a map file, the format is decided by the file extension
+func loadMap(path string) (*GameMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m *GameMap
+	if strings.HasSuffix(path, ".json") {
+		m = &GameMap{}
+		err = json.NewDecoder(f).Decode(m)
+	} else {
+		m, err = parseTextMap(bufio.NewScanner(f))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[loadMap] %s: %w", path, err)
+	}
+	if m.Name == "" {
+		m.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err = m.validate(); err != nil {
+		return nil, fmt.Errorf("[loadMap] %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// parseTextMap parse a grid like:
+//
+//	; comment
+//	S..*#
+//	.#I*.
+//
+// every line is a row, and all rows must have the same length
+func parseTextMap(scanner *bufio.Scanner) (*GameMap, error) {
+	m := &GameMap{}
+	y := 0
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, mapCommentPrefix) {
+			continue
+		}
+		if m.Width == 0 {
+			m.Width = len(line)
+		} else if len(line) != m.Width {
+			return nil, fmt.Errorf("row %d has %d cells, expect %d", y, len(line), m.Width)
+		}
+		for x, c := range line {
+			pos := Position{X: x, Y: y}
+			switch c {
+			case mapEmptyChar:
+			case mapWallChar:
+				m.Walls = append(m.Walls, pos)
+			case mapBlockChar:
+				m.Blocks = append(m.Blocks, pos)
+			case mapSpawnChar:
+				m.Spawns = append(m.Spawns, pos)
+			case mapItemSpawnerChar:
+				m.ItemSpawners = append(m.ItemSpawners, pos)
+			default:
+				return nil, fmt.Errorf("unknown cell %q at (%d, %d)", c, x, y)
+			}
+		}
+		y++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	m.Height = y
+	return m, nil
+}
+
+// text encode the map to the text grid format
+func (m *GameMap) text() string {
+	grid := make([][]byte, m.Height)
+	for y := range grid {
+		grid[y] = []byte(strings.Repeat(string(mapEmptyChar), m.Width))
+	}
+	fill := func(positions []Position, c byte) {
+		for _, p := range positions {
+			grid[p.Y][p.X] = c
+		}
+	}
+	fill(m.Walls, mapWallChar)
+	fill(m.Blocks, mapBlockChar)
+	fill(m.Spawns, mapSpawnChar)
+	fill(m.ItemSpawners, mapItemSpawnerChar)
+
+	sb := strings.Builder{}
+	sb.WriteString(mapCommentPrefix + " " + m.Name + "\n")
+	for _, row := range grid {
+		sb.Write(row)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func (m *GameMap) size() mapSize {
+	return mapSize{width: m.Width, height: m.Height}
+}
+
+func (m *GameMap) inBounds(pos Position) bool {
+	return m.size().validCoordinate(pos)
+}
+
+// validate check the bounds, overlaps and the reachability of spawns
+func (m *GameMap) validate() error {
+	if m.Width <= 0 || m.Height <= 0 {
+		return fmt.Errorf("invalid map size %dx%d", m.Width, m.Height)
+	}
+	if m.Width > maxMapLength || m.Height > maxMapLength {
+		return fmt.Errorf("map size %dx%d is larger than %dx%d",
+			m.Width, m.Height, maxMapLength, maxMapLength)
+	}
+	if len(m.Spawns) == 0 {
+		return fmt.Errorf("map has no spawn point")
+	}
+
+	// every cell can only hold one thing
+	cells := map[Position]string{}
+	for kind, positions := range map[string][]Position{
+		"wall":         m.Walls,
+		"block":        m.Blocks,
+		"spawn":        m.Spawns,
+		"item spawner": m.ItemSpawners,
+	} {
+		for _, p := range positions {
+			if !m.inBounds(p) {
+				return fmt.Errorf("%s (%d, %d) is out of bounds", kind, p.X, p.Y)
+			}
+			if other, ok := cells[p]; ok {
+				return fmt.Errorf("%s and %s overlap at (%d, %d)", kind, other, p.X, p.Y)
+			}
+			cells[p] = kind
+		}
+	}
+
+	// destructible blocks can be bombed, so only walls stop players
+	reachable := m.reachableFrom(m.Spawns[0])
+	for _, p := range m.Spawns {
+		if !reachable[p] {
+			return fmt.Errorf("spawn (%d, %d) is unreachable", p.X, p.Y)
+		}
+	}
+	return nil
+}
+
+// reachableFrom BFS from start, walls are not passable
+func (m *GameMap) reachableFrom(start Position) map[Position]bool {
+	walls := map[Position]bool{}
+	for _, p := range m.Walls {
+		walls[p] = true
+	}
+	visited := map[Position]bool{start: true}
+	queue := []Position{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range neighbours(cur) {
+			if !m.inBounds(next) || walls[next] || visited[next] {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return visited
+}
+
+// obstacleCodes encode obstacles as UpdateMapEvent does
+func (m *GameMap) obstacleCodes() []int {
+	var codes []int
+	size := m.size()
+	for _, p := range m.Walls {
+		codes = append(codes, obstacleCode(size, p, indestructibleObstacleType))
+	}
+	for _, p := range m.Blocks {
+		codes = append(codes, obstacleCode(size, p, destructibleObstacleType))
+	}
+	return codes
+}
+
+// obstacleCode of the obstacle at pos, destructible obstacles are negative numbers
+// offset by one, so a block at 0,0 is not a wall
+func obstacleCode(size mapSize, pos Position, t ObstacleType) int {
+	code := size.encodeXY(pos.X, pos.Y)
+	if t == destructibleObstacleType {
+		return -(code + 1)
+	}
+	return code
+}
+
+// decodeObstacle is the reverse of obstacleCode
+func decodeObstacle(size mapSize, code int) (Position, ObstacleType) {
+	t := indestructibleObstacleType
+	if code < 0 {
+		t = destructibleObstacleType
+		code = -code - 1
+	}
+	x, y := size.decodeXY(code)
+	return Position{X: x, Y: y}, t
+}
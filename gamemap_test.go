@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObstacleCodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		walls, blocks []Position
+	}{
+		{name: "block at 0,0", blocks: []Position{{X: 0, Y: 0}}},
+		{name: "wall at 0,0", walls: []Position{{X: 0, Y: 0}}},
+		{
+			name:   "corners",
+			walls:  []Position{{X: 4, Y: 0}, {X: 0, Y: 2}},
+			blocks: []Position{{X: 0, Y: 0}, {X: 4, Y: 2}},
+		},
+		{name: "no obstacle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gameMap := &GameMap{Width: 5, Height: 3, Walls: tt.walls, Blocks: tt.blocks, Spawns: []Position{{X: 2, Y: 1}}}
+			want := map[Position]ObstacleType{}
+			for _, p := range tt.walls {
+				want[p] = indestructibleObstacleType
+			}
+			for _, p := range tt.blocks {
+				want[p] = destructibleObstacleType
+			}
+			// through a message, as the clients of a room receive it
+			msg := convertEventToMsg(&UpdateMapEvent{Obstacles: gameMap.obstacleCodes(), gameMap: gameMap})
+			g := newGameState(defaultConfig(), newSimClock(), 1)
+			convertMsgToEvent(msg).handle(g)
+			if !reflect.DeepEqual(g.obstacleMap, want) {
+				t.Errorf("obstacles %v, want %v", g.obstacleMap, want)
+			}
+		})
+	}
+}
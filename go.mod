@@ -5,7 +5,6 @@ go 1.19
 require (
 	github.com/apache/pulsar-client-go v0.9.0
 	github.com/hajimehoshi/ebiten/v2 v2.4.3
-	github.com/hashicorp/golang-lru v0.5.1
 	github.com/sirupsen/logrus v1.9.0
 )
 
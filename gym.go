@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// agent is a player controlled through the gym api, it repeats its last action every tick
+type agent struct {
+	name  string
+	mover *mover
+	next  intent
+}
+
+// gymActions map the actions of the gym api to intents
+var gymActions = map[string]intent{
+	"stay":     {},
+	"left":     {held: map[Direction]bool{dirLeft: true}, pressed: dirLeft},
+	"right":    {held: map[Direction]bool{dirRight: true}, pressed: dirRight},
+	"up":       {held: map[Direction]bool{dirUp: true}, pressed: dirUp},
+	"down":     {held: map[Direction]bool{dirDown: true}, pressed: dirDown},
+	"bomb":     {bomb: true},
+	"detonate": {detonate: true},
+}
+
+// gymOptions are the fields of a reset request, missing fields keep their default
+type gymOptions struct {
+	Seed int64 `json:"seed"`
+	// names of the agents
+	Agents []string `json:"agents"`
+	// difficulties of the bots playing against the agents
+	Bots      []string `json:"bots"`
+	Generator string   `json:"generator"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	// cells per second of the agents
+	Speed float64 `json:"speed"`
+	// game ticks of a step, an action is held during the whole step
+	Ticks int `json:"ticks"`
+	// the episode is truncated after maxSeconds of game time
+	MaxSeconds  float64 `json:"maxSeconds"`
+	KillReward  float64 `json:"killReward"`
+	DeathReward float64 `json:"deathReward"`
+}
+
+// defaultGymOptions are new for every request, a request may change them
+func defaultGymOptions() gymOptions {
+	return gymOptions{
+		Agents:    []string{"agent1"},
+		Generator: defaultGenerator,
+		Width:     xGridCountInScreen,
+		Height:    yGridCountInScreen,
+		Speed:     defaultSpeed,
+		// about one cell at the default speed
+		Ticks:       10,
+		MaxSeconds:  matchTimeLimit.Seconds(),
+		KillReward:  1,
+		DeathReward: -1,
+	}
+}
+
+// gymRequest is a line of the gym protocol, cmd is reset, step or close
+type gymRequest struct {
+	Cmd string `json:"cmd"`
+	gymOptions
+	// action of every agent for a step, agents without an action stay
+	Actions map[string]string `json:"actions"`
+}
+
+// gymObservation is what an agent sees, grids are indexed by [y][x]
+type gymObservation struct {
+	// 1 for destructible and 2 for indestructible obstacles
+	Obstacles [][]int `json:"obstacles"`
+	// seconds until the bomb explodes, 0 without a bomb
+	Bombs [][]float64 `json:"bombs"`
+	// 1 for burning grids
+	Flames [][]int `json:"flames"`
+	// 1 for the agent itself, 2 for the other players alive
+	Players [][]int `json:"players"`
+	X       int     `json:"x"`
+	Y       int     `json:"y"`
+	Alive   bool    `json:"alive"`
+}
+
+// gymResponse answers a request, error is set when the request failed
+type gymResponse struct {
+	Observations map[string]*gymObservation `json:"observations,omitempty"`
+	Rewards      map[string]float64         `json:"rewards,omitempty"`
+	// an agent is done when it dies
+	Dones map[string]bool `json:"dones,omitempty"`
+	// the episode is over when every agent is dead or one player is alive
+	Done bool `json:"done"`
+	// the episode reached maxSeconds
+	Truncated bool `json:"truncated"`
+	// game time of the episode in seconds
+	Time  float64 `json:"time"`
+	Error string  `json:"error,omitempty"`
+}
+
+// gymEnv runs a simulated game for reinforcement learning,
+// the game only moves when stepped
+type gymEnv struct {
+	options gymOptions
+	clock   *simClock
+	game    *Game
+	start   time.Time
+	// stats of the agents after the last step, to reward the changes
+	last map[string]playerStats
+}
+
+// reset start a new episode on a generated map
+func (e *gymEnv) reset(options gymOptions, cfg *config) (*gymResponse, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	gameMap, err := generateMap(options.Generator, options.Seed, options.Width, options.Height)
+	if err != nil {
+		return nil, err
+	}
+	var players []playerOptions
+	for _, name := range options.Agents {
+		players = append(players, playerOptions{
+			name:   name,
+			avatar: defaultAvatar,
+			speed:  options.Speed,
+			agent:  true,
+		})
+	}
+	for i, level := range options.Bots {
+		players = append(players, playerOptions{
+			name:   fmt.Sprintf("bot%d", i+1),
+			avatar: avatarNames()[i%len(skins)],
+			bot:    level,
+		})
+	}
+
+	e.options = options
+	e.clock = newSimClock()
+	e.game = newSimGame(players, cfg, e.clock, options.Seed)
+	e.game.elimination = true
+	e.game.sendAsync(&UpdateMapEvent{
+		Obstacles: gameMap.obstacleCodes(),
+		gameMap:   gameMap,
+	})
+	e.game.drainEvents()
+	e.start = e.clock.Now()
+	e.last = map[string]playerStats{}
+	for _, name := range options.Agents {
+		e.last[name] = *e.game.stats(name)
+	}
+	return &gymResponse{Observations: e.observations()}, nil
+}
+
+func (o gymOptions) validate() error {
+	if len(o.Agents) == 0 {
+		return errors.New("no agent")
+	}
+	seen := map[string]bool{}
+	for i, name := range o.Agents {
+		if err := validPlayerName(name); err != nil {
+			return fmt.Errorf("invalid agent name: %w", err)
+		}
+		seen[name] = true
+		if len(seen) != i+1 {
+			return fmt.Errorf("duplicate agent name %q", name)
+		}
+	}
+	for i, level := range o.Bots {
+		if _, ok := difficulties[level]; !ok {
+			return fmt.Errorf("unknown bot difficulty %q", level)
+		}
+		if name := fmt.Sprintf("bot%d", i+1); seen[name] {
+			return fmt.Errorf("agent name %q is taken by a bot", name)
+		}
+	}
+	if _, ok := mapGenerators[o.Generator]; !ok {
+		return fmt.Errorf("unknown generator %q", o.Generator)
+	}
+	if o.Width <= 0 || o.Height <= 0 || o.Ticks <= 0 {
+		return errors.New("width, height and ticks must be positive")
+	}
+	return nil
+}
+
+// step apply the actions of the agents, then run the game for the ticks of a step
+func (e *gymEnv) step(actions map[string]string) (*gymResponse, error) {
+	if e.game == nil {
+		return nil, errors.New("step before reset")
+	}
+	for name, action := range actions {
+		if _, ok := gymActions[action]; !ok {
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+		if _, ok := e.last[name]; !ok {
+			return nil, fmt.Errorf("unknown agent %q", name)
+		}
+	}
+	for _, a := range e.game.agents {
+		a.next = gymActions[actions[a.name]]
+		if !e.game.nameToPlayers[a.name].alive {
+			a.next = intent{}
+		}
+	}
+
+	g := e.game
+	for i := 0; i < e.options.Ticks; i++ {
+		g.drainEvents()
+		if err := g.Update(); err != nil {
+			return nil, err
+		}
+		e.clock.advance(simTick)
+	}
+	g.drainEvents()
+
+	response := &gymResponse{
+		Observations: e.observations(),
+		Rewards:      map[string]float64{},
+		Dones:        map[string]bool{},
+		Time:         e.clock.Now().Sub(e.start).Seconds(),
+	}
+	agentsAlive := 0
+	for _, a := range g.agents {
+		s := *g.stats(a.name)
+		last := e.last[a.name]
+		response.Rewards[a.name] = float64(s.kills-last.kills)*e.options.KillReward +
+			float64(s.deaths-last.deaths)*e.options.DeathReward
+		e.last[a.name] = s
+		alive := g.nameToPlayers[a.name].alive
+		response.Dones[a.name] = !alive
+		if alive {
+			agentsAlive++
+		}
+	}
+	alive := 0
+	for _, player := range g.nameToPlayers {
+		if player.alive {
+			alive++
+		}
+	}
+	response.Done = agentsAlive == 0 || (len(g.nameToPlayers) > 1 && alive <= 1)
+	response.Truncated = !response.Done && response.Time >= e.options.MaxSeconds
+	return response, nil
+}
+
+// observations of every agent
+func (e *gymEnv) observations() map[string]*gymObservation {
+	g := e.game
+	now := g.clock.Now()
+	grid := func() [][]int {
+		rows := make([][]int, g.size.height)
+		for y := range rows {
+			rows[y] = make([]int, g.size.width)
+		}
+		return rows
+	}
+
+	// the grids every agent shares
+	obstacles := grid()
+	g.obstacleLock.RLock()
+	for pos, t := range g.obstacleMap {
+		if g.size.validCoordinate(pos) {
+			obstacles[pos.Y][pos.X] = int(t)
+		}
+	}
+	g.obstacleLock.RUnlock()
+	flames := grid()
+	g.flameLock.RLock()
+	for pos, bomb := range g.flameMap {
+		if bomb != nil && g.size.validCoordinate(pos) {
+			flames[pos.Y][pos.X] = 1
+		}
+	}
+	g.flameLock.RUnlock()
+	bombs := make([][]float64, g.size.height)
+	for y := range bombs {
+		bombs[y] = make([]float64, g.size.width)
+	}
+	for _, bomb := range g.nameToBombs {
+		if !g.size.validCoordinate(bomb.pos) {
+			continue
+		}
+		fuse := explodeTime*time.Second - now.Sub(bomb.setTime)
+		if fuse < simTick {
+			// the explosion is being handled
+			fuse = simTick
+		}
+		bombs[bomb.pos.Y][bomb.pos.X] = fuse.Seconds()
+	}
+
+	observations := map[string]*gymObservation{}
+	for _, a := range g.agents {
+		self := g.nameToPlayers[a.name]
+		players := grid()
+		for _, player := range g.nameToPlayers {
+			if player.alive && player != self && g.size.validCoordinate(player.pos) {
+				players[player.pos.Y][player.pos.X] = 2
+			}
+		}
+		if self.alive {
+			players[self.pos.Y][self.pos.X] = 1
+		}
+		observations[a.name] = &gymObservation{
+			Obstacles: obstacles,
+			Bombs:     bombs,
+			Flames:    flames,
+			Players:   players,
+			X:         self.pos.X,
+			Y:         self.pos.Y,
+			Alive:     self.alive,
+		}
+	}
+	return observations
+}
+
+// runGym serve the gym protocol, a json request per line on r and a json response per line on w
+func runGym(r io.Reader, w io.Writer, cfg *config) error {
+	env := &gymEnv{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		request := gymRequest{gymOptions: defaultGymOptions()}
+		var response *gymResponse
+		err := json.Unmarshal([]byte(line), &request)
+		if err == nil {
+			switch request.Cmd {
+			case "reset":
+				response, err = env.reset(request.gymOptions, cfg)
+			case "step":
+				response, err = env.step(request.Actions)
+			case "close":
+				return nil
+			default:
+				err = fmt.Errorf("unknown cmd %q", request.Cmd)
+			}
+		}
+		if err != nil {
+			response = &gymResponse{Error: err.Error()}
+		}
+		if err = encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gymLines run the gym protocol on lines and return the responses
+func gymLines(t *testing.T, lines ...string) []gymResponse {
+	t.Helper()
+	var out bytes.Buffer
+	if err := runGym(strings.NewReader(strings.Join(lines, "\n")), &out, defaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	var responses []gymResponse
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var response gymResponse
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func TestGymRequests(t *testing.T) {
+	reset := `{"cmd": "reset", "seed": 1, "agents": ["alice", "bob"]}`
+	tests := []struct {
+		name  string
+		lines []string
+		// the error of the last response, empty if it must succeed
+		err string
+	}{
+		{name: "reset", lines: []string{reset}},
+		{name: "step", lines: []string{reset, `{"cmd": "step", "actions": {"alice": "left", "bob": "bomb"}}`}},
+		{name: "step without actions", lines: []string{reset, `{"cmd": "step"}`}},
+		{name: "malformed line", lines: []string{`{"cmd": "reset"`}, err: "unexpected end"},
+		{name: "not json", lines: []string{`reset`}, err: "invalid character"},
+		{name: "unknown cmd", lines: []string{`{"cmd": "jump"}`}, err: "unknown cmd"},
+		{name: "step before reset", lines: []string{`{"cmd": "step"}`}, err: "before reset"},
+		{name: "unknown action", lines: []string{reset, `{"cmd": "step", "actions": {"alice": "jump"}}`}, err: "unknown action"},
+		{name: "unknown agent", lines: []string{reset, `{"cmd": "step", "actions": {"carol": "left"}}`}, err: "unknown agent"},
+		{name: "no agent", lines: []string{`{"cmd": "reset", "agents": []}`}, err: "no agent"},
+		{name: "duplicate agent", lines: []string{`{"cmd": "reset", "agents": ["alice", "alice"]}`}, err: "duplicate"},
+		{name: "invalid agent name", lines: []string{`{"cmd": "reset", "agents": ["a-b"]}`}, err: "invalid agent name"},
+		{name: "agent named like a bot", lines: []string{`{"cmd": "reset", "agents": ["bot1"], "bots": ["easy"]}`}, err: "taken by a bot"},
+		{name: "unknown bot", lines: []string{`{"cmd": "reset", "bots": ["expert"]}`}, err: "unknown bot"},
+		{name: "unknown generator", lines: []string{`{"cmd": "reset", "generator": "lake"}`}, err: "unknown generator"},
+		{name: "no width", lines: []string{`{"cmd": "reset", "width": 0}`}, err: "must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := gymLines(t, tt.lines...)
+			if len(responses) != len(tt.lines) {
+				t.Fatalf("%d responses to %d lines", len(responses), len(tt.lines))
+			}
+			last := responses[len(responses)-1]
+			if tt.err == "" && last.Error != "" {
+				t.Errorf("error %q, want none", last.Error)
+			}
+			if !strings.Contains(last.Error, tt.err) {
+				t.Errorf("error %q, want %q", last.Error, tt.err)
+			}
+			if tt.err == "" && len(last.Observations) != 2 {
+				t.Errorf("%d observations, want alice and bob", len(last.Observations))
+			}
+		})
+	}
+}
+
+func TestGymDefaults(t *testing.T) {
+	responses := gymLines(t,
+		`{"cmd": "reset", "agents": ["alice", "bob"]}`,
+		`{"cmd": "reset"}`,
+		`{"cmd": "close"}`,
+		`{"cmd": "reset"}`,
+	)
+	if len(responses) != 2 {
+		t.Fatalf("%d responses, want none after close", len(responses))
+	}
+	if _, ok := responses[1].Observations["agent1"]; !ok || len(responses[1].Observations) != 1 {
+		t.Errorf("the agents of a request changed the defaults: %v", responses[1].Observations)
+	}
+}
+
+// testGymEnv reset an episode of agents at positions on an open 12x3 map
+func testGymEnv(t *testing.T, options gymOptions, positions map[string]Position) *gymEnv {
+	t.Helper()
+	for name := range positions {
+		options.Agents = append(options.Agents, name)
+	}
+	e := &gymEnv{}
+	if _, err := e.reset(options, defaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	gameMap := &GameMap{Width: 12, Height: 3, Spawns: []Position{{X: 0, Y: 0}}}
+	e.game.sendAsync(&UpdateMapEvent{Obstacles: gameMap.obstacleCodes(), gameMap: gameMap})
+	for name, pos := range positions {
+		e.game.sendAsync(&UserMoveEvent{playerInfo: &playerInfo{name: name, avatar: defaultAvatar, pos: pos, alive: true}})
+	}
+	e.game.drainEvents()
+	return e
+}
+
+func TestGymStep(t *testing.T) {
+	// alice sets a bomb in the row of bob, then leaves the row and the column of the bomb
+	kill := []map[string]string{{"alice": "bomb"}, {"alice": "left"}, {"alice": "up"}}
+	wait := int(2*explodeTime*time.Second/(10*simTick)) + 1
+
+	tests := []struct {
+		name       string
+		maxSeconds float64
+		positions  map[string]Position
+		steps      []map[string]string
+		// then the agents stay for wait steps
+		wait bool
+		// the position of alice after the steps
+		want        Position
+		rewards     map[string]float64
+		dones       map[string]bool
+		done, trunc bool
+	}{
+		{
+			name:      "stay",
+			positions: map[string]Position{"alice": {X: 2, Y: 1}, "bob": {X: 9, Y: 1}},
+			steps:     []map[string]string{{}},
+			want:      Position{X: 2, Y: 1},
+			rewards:   map[string]float64{"alice": 0, "bob": 0},
+			dones:     map[string]bool{"alice": false, "bob": false},
+		},
+		{
+			name:      "move",
+			positions: map[string]Position{"alice": {X: 2, Y: 1}, "bob": {X: 9, Y: 1}},
+			steps:     []map[string]string{{"alice": "right"}, {"alice": "down"}},
+			want:      Position{X: 3, Y: 2},
+			rewards:   map[string]float64{"alice": 0, "bob": 0},
+			dones:     map[string]bool{"alice": false, "bob": false},
+		},
+		{
+			name:      "kill",
+			positions: map[string]Position{"alice": {X: 2, Y: 1}, "bob": {X: 6, Y: 1}},
+			steps:     kill,
+			wait:      true,
+			want:      Position{X: 1, Y: 0},
+			rewards:   map[string]float64{"alice": 1, "bob": -1},
+			dones:     map[string]bool{"alice": false, "bob": true},
+			done:      true,
+		},
+		{
+			name:      "suicide",
+			positions: map[string]Position{"alice": {X: 2, Y: 1}},
+			steps:     []map[string]string{{"alice": "bomb"}},
+			wait:      true,
+			want:      Position{X: 2, Y: 1},
+			rewards:   map[string]float64{"alice": -1},
+			dones:     map[string]bool{"alice": true},
+			done:      true,
+		},
+		{
+			name:       "truncated",
+			maxSeconds: 0.1,
+			positions:  map[string]Position{"alice": {X: 2, Y: 1}, "bob": {X: 9, Y: 1}},
+			steps:      []map[string]string{{}},
+			want:       Position{X: 2, Y: 1},
+			rewards:    map[string]float64{"alice": 0, "bob": 0},
+			dones:      map[string]bool{"alice": false, "bob": false},
+			trunc:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := defaultGymOptions()
+			options.Agents = nil
+			if tt.maxSeconds > 0 {
+				options.MaxSeconds = tt.maxSeconds
+			}
+			e := testGymEnv(t, options, tt.positions)
+			steps := tt.steps
+			if tt.wait {
+				for i := 0; i < wait; i++ {
+					steps = append(steps, map[string]string{})
+				}
+			}
+			rewards := map[string]float64{}
+			var response *gymResponse
+			for i, actions := range steps {
+				var err error
+				if response, err = e.step(actions); err != nil {
+					t.Fatal(err)
+				}
+				if want := time.Duration(i+1) * 10 * simTick; response.Time != want.Seconds() {
+					t.Fatalf("time %v after %d steps, want %v", response.Time, i+1, want.Seconds())
+				}
+				for name, r := range response.Rewards {
+					rewards[name] += r
+				}
+			}
+			if o := response.Observations["alice"]; (Position{X: o.X, Y: o.Y}) != tt.want {
+				t.Errorf("alice at %d,%d, want %v", o.X, o.Y, tt.want)
+			}
+			if !reflect.DeepEqual(rewards, tt.rewards) {
+				t.Errorf("rewards %v, want %v", rewards, tt.rewards)
+			}
+			for name, done := range tt.dones {
+				if response.Dones[name] != done || response.Observations[name].Alive == done {
+					t.Errorf("%s done %v, alive %v, want done %v", name, response.Dones[name], response.Observations[name].Alive, done)
+				}
+			}
+			if response.Done != tt.done || response.Truncated != tt.trunc {
+				t.Errorf("done %v, truncated %v, want %v, %v", response.Done, response.Truncated, tt.done, tt.trunc)
+			}
+		})
+	}
+}
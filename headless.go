@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// runHeadless update the game at the rate of ebiten without a window until interrupted,
+// for bots and servers
+func runHeadless(g *Game) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(time.Second / ebiten.DefaultTPS)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// nothing is drawn, so every event received is handled at once
+			g.drainEvents()
+			if err := g.Update(); err != nil {
+				log.Error("[runHeadless]", err)
+				return
+			}
+		case <-interrupt:
+			return
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	log "github.com/sirupsen/logrus"
+	"math"
+)
+
+// action is what a player wants to do, keys and gamepad buttons are bound to actions
+type action string
+
+const (
+	actionLeft       action = "left"
+	actionRight      action = "right"
+	actionDown       action = "down"
+	actionUp         action = "up"
+	actionBomb       action = "bomb"
+	actionDetonate   action = "detonate"
+	actionRevive     action = "revive"
+	actionChat       action = "chat"
+	actionScoreboard action = "scoreboard"
+	// the global leaderboard of the profiles
+	actionLeaderboard action = "leaderboard"
+)
+
+// allActions in the order of rebinding
+var allActions = []action{
+	actionLeft, actionRight, actionDown, actionUp,
+	actionBomb, actionDetonate, actionRevive, actionChat, actionScoreboard, actionLeaderboard,
+}
+
+var directionActions = map[Direction]action{
+	dirLeft:  actionLeft,
+	dirRight: actionRight,
+	dirDown:  actionDown,
+	dirUp:    actionUp,
+}
+
+const defaultDeadzone = 0.3
+
+// maxLocalPlayers is how many players can play on one client
+const maxLocalPlayers = 4
+
+// defaultBindings of every local player, the first two players share the keyboard,
+// and the others only have gamepads
+func defaultBindings() []bindings {
+	players := make([]bindings, maxLocalPlayers)
+	for i := range players {
+		players[i] = bindings{
+			Keys:    map[action][]ebiten.Key{},
+			Buttons: defaultButtonBindings(),
+			Gamepad: i,
+		}
+	}
+	players[0].Keys = map[action][]ebiten.Key{
+		actionLeft:        {ebiten.KeyArrowLeft, ebiten.KeyA},
+		actionRight:       {ebiten.KeyArrowRight, ebiten.KeyD},
+		actionDown:        {ebiten.KeyArrowDown, ebiten.KeyS},
+		actionUp:          {ebiten.KeyArrowUp, ebiten.KeyW},
+		actionBomb:        {ebiten.KeySpace},
+		actionDetonate:    {ebiten.KeyE},
+		actionRevive:      {ebiten.KeyR},
+		actionChat:        {ebiten.KeyEnter},
+		actionScoreboard:  {ebiten.KeyTab},
+		actionLeaderboard: {ebiten.KeyG},
+	}
+	players[1].Keys = map[action][]ebiten.Key{
+		actionLeft:     {ebiten.KeyJ},
+		actionRight:    {ebiten.KeyL},
+		actionDown:     {ebiten.KeyK},
+		actionUp:       {ebiten.KeyI},
+		actionBomb:     {ebiten.KeyU},
+		actionDetonate: {ebiten.KeyO},
+		actionRevive:   {ebiten.KeyP},
+	}
+	return players
+}
+
+// gamepadButtonNames name the buttons of the standard layout in the config file
+var gamepadButtonNames = map[string]ebiten.StandardGamepadButton{
+	"a":      ebiten.StandardGamepadButtonRightBottom,
+	"b":      ebiten.StandardGamepadButtonRightRight,
+	"x":      ebiten.StandardGamepadButtonRightLeft,
+	"y":      ebiten.StandardGamepadButtonRightTop,
+	"lb":     ebiten.StandardGamepadButtonFrontTopLeft,
+	"rb":     ebiten.StandardGamepadButtonFrontTopRight,
+	"lt":     ebiten.StandardGamepadButtonFrontBottomLeft,
+	"rt":     ebiten.StandardGamepadButtonFrontBottomRight,
+	"back":   ebiten.StandardGamepadButtonCenterLeft,
+	"start":  ebiten.StandardGamepadButtonCenterRight,
+	"ls":     ebiten.StandardGamepadButtonLeftStick,
+	"rs":     ebiten.StandardGamepadButtonRightStick,
+	"dup":    ebiten.StandardGamepadButtonLeftTop,
+	"ddown":  ebiten.StandardGamepadButtonLeftBottom,
+	"dleft":  ebiten.StandardGamepadButtonLeftLeft,
+	"dright": ebiten.StandardGamepadButtonLeftRight,
+	"home":   ebiten.StandardGamepadButtonCenterCenter,
+}
+
+func defaultButtonBindings() map[action][]string {
+	return map[action][]string{
+		actionLeft:        {"dleft"},
+		actionRight:       {"dright"},
+		actionDown:        {"ddown"},
+		actionUp:          {"dup"},
+		actionBomb:        {"a"},
+		actionDetonate:    {"b"},
+		actionRevive:      {"y"},
+		actionChat:        {"back"},
+		actionScoreboard:  {"x"},
+		actionLeaderboard: {"start"},
+	}
+}
+
+// controls read the keyboard and a gamepad of a player
+type controls struct {
+	keys     map[action][]ebiten.Key
+	buttons  map[action][]ebiten.StandardGamepadButton
+	deadzone float64
+
+	// index of the gamepad among connected gamepads, -1 for no gamepad
+	gamepad int
+	// direction of the left stick in this tick and the last tick
+	stick, lastStick Direction
+}
+
+// newControls read the bindings of the index-th local player
+func newControls(cfg *config, index int) *controls {
+	b := cfg.Players[index]
+	c := &controls{
+		keys:     map[action][]ebiten.Key{},
+		buttons:  map[action][]ebiten.StandardGamepadButton{},
+		deadzone: cfg.Deadzone,
+		gamepad:  b.Gamepad,
+	}
+	for a, keys := range b.Keys {
+		c.keys[a] = keys
+	}
+	for a, names := range b.Buttons {
+		for _, name := range names {
+			button, ok := gamepadButtonNames[name]
+			if !ok {
+				log.Warningf("unknown gamepad button %q of %s", name, a)
+				continue
+			}
+			c.buttons[a] = append(c.buttons[a], button)
+		}
+	}
+	return c
+}
+
+// gamepadID find the gamepad to read, false if none is connected
+func (c *controls) gamepadID() (ebiten.GamepadID, bool) {
+	if c.gamepad < 0 {
+		return 0, false
+	}
+	i := 0
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		if i == c.gamepad {
+			return id, true
+		}
+		i++
+	}
+	return 0, false
+}
+
+// update must be called once every tick before reading actions
+func (c *controls) update() {
+	c.lastStick = c.stick
+	c.stick = dirNone
+	id, ok := c.gamepadID()
+	if !ok {
+		return
+	}
+	x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+	y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+	if math.Hypot(x, y) < c.deadzone {
+		return
+	}
+	// the dominant axis decides the direction
+	if math.Abs(x) > math.Abs(y) {
+		if x < 0 {
+			c.stick = dirLeft
+		} else {
+			c.stick = dirRight
+		}
+	} else if y < 0 {
+		c.stick = dirUp
+	} else {
+		c.stick = dirDown
+	}
+}
+
+// pressed reports whether the action is being held
+func (c *controls) pressed(a action) bool {
+	for _, key := range c.keys[a] {
+		if ebiten.IsKeyPressed(key) {
+			return true
+		}
+	}
+	id, ok := c.gamepadID()
+	if !ok {
+		return false
+	}
+	for _, button := range c.buttons[a] {
+		if ebiten.IsStandardGamepadButtonPressed(id, button) {
+			return true
+		}
+	}
+	return directionActions[c.stick] == a
+}
+
+// justPressed reports whether the action starts in this tick
+func (c *controls) justPressed(a action) bool {
+	for _, key := range c.keys[a] {
+		if inpututil.IsKeyJustPressed(key) {
+			return true
+		}
+	}
+	id, ok := c.gamepadID()
+	if !ok {
+		return false
+	}
+	for _, button := range c.buttons[a] {
+		if inpututil.IsStandardGamepadButtonJustPressed(id, button) {
+			return true
+		}
+	}
+	return c.stick != c.lastStick && directionActions[c.stick] == a
+}
+
+// directions are the held directions and the direction just pressed
+func (c *controls) directions() (map[Direction]bool, Direction) {
+	held := map[Direction]bool{}
+	pressed := dirNone
+	for _, dir := range []Direction{dirLeft, dirRight, dirDown, dirUp} {
+		a := directionActions[dir]
+		if c.pressed(a) {
+			held[dir] = true
+		}
+		if c.justPressed(a) {
+			pressed = dir
+		}
+	}
+	return held, pressed
+}
+
+// keyName is the first key bound to the action, for hints
+func (c *controls) keyName(a action) string {
+	if len(c.keys[a]) == 0 {
+		return "?"
+	}
+	return c.keys[a][0].String()
+}
+
+// rebinder asks for a new key or gamepad button of every action in turn
+type rebinder struct {
+	active bool
+	index  int
+}
+
+func (r *rebinder) start() {
+	r.active = true
+	r.index = 0
+}
+
+// update bind the first key or button pressed to the current action,
+// Escape keeps the current binding. Return true when all actions are done.
+func (r *rebinder) update(c *controls) bool {
+	a := allActions[r.index]
+	done := false
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		done = true
+	} else if keys := inpututil.AppendPressedKeys(nil); len(keys) > 0 {
+		for _, key := range keys {
+			if inpututil.IsKeyJustPressed(key) {
+				c.bindKey(a, key)
+				done = true
+				break
+			}
+		}
+	}
+	if id, ok := c.gamepadID(); ok && !done {
+		for _, button := range gamepadButtonNames {
+			if inpututil.IsStandardGamepadButtonJustPressed(id, button) {
+				c.bindButton(a, button)
+				done = true
+				break
+			}
+		}
+	}
+	if done {
+		r.index++
+	}
+	if r.index >= len(allActions) {
+		r.active = false
+		return true
+	}
+	return false
+}
+
+// bindKey make key the only key of a, the other actions lose it
+func (c *controls) bindKey(a action, key ebiten.Key) {
+	for other, keys := range c.keys {
+		c.keys[other] = removeKey(keys, key)
+	}
+	c.keys[a] = []ebiten.Key{key}
+}
+
+// bindButton make button the only button of a, the other actions lose it
+func (c *controls) bindButton(a action, button ebiten.StandardGamepadButton) {
+	for other, buttons := range c.buttons {
+		c.buttons[other] = removeButton(buttons, button)
+	}
+	c.buttons[a] = []ebiten.StandardGamepadButton{button}
+}
+
+func removeKey(keys []ebiten.Key, key ebiten.Key) []ebiten.Key {
+	var kept []ebiten.Key
+	for _, k := range keys {
+		if k != key {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+func removeButton(buttons []ebiten.StandardGamepadButton, button ebiten.StandardGamepadButton) []ebiten.StandardGamepadButton {
+	var kept []ebiten.StandardGamepadButton
+	for _, b := range buttons {
+		if b != button {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+func (r *rebinder) prompt() string {
+	return fmt.Sprintf("press a key or button for %q, Esc to keep", allActions[r.index])
+}
+
+// saveTo write the current bindings as the index-th local player to cfg and save it
+func (c *controls) saveTo(cfg *config, index int) error {
+	cfg.Players[index] = c.bindings()
+	return cfg.save()
+}
+
+// bindings are the current bindings as written in the config file,
+// actions without keys or buttons are written too so they don't get the default back
+func (c *controls) bindings() bindings {
+	b := bindings{
+		Keys:    map[action][]ebiten.Key{},
+		Buttons: map[action][]string{},
+		Gamepad: c.gamepad,
+	}
+	for a, keys := range c.keys {
+		b.Keys[a] = keys
+	}
+	for a, buttons := range c.buttons {
+		b.Buttons[a] = []string{}
+		for _, button := range buttons {
+			for name, gb := range gamepadButtonNames {
+				if gb == button {
+					b.Buttons[a] = append(b.Buttons[a], name)
+					break
+				}
+			}
+		}
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name string
+		bind func(c *controls)
+		// the bindings of bomb and detonate after bind
+		bombKeys, detonateKeys       []ebiten.Key
+		bombButtons, detonateButtons []ebiten.StandardGamepadButton
+	}{
+		{
+			name:            "free key",
+			bind:            func(c *controls) { c.bindKey(actionBomb, ebiten.KeyZ) },
+			bombKeys:        []ebiten.Key{ebiten.KeyZ},
+			detonateKeys:    []ebiten.Key{ebiten.KeyE},
+			bombButtons:     []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightBottom},
+			detonateButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightRight},
+		},
+		{
+			name:            "key of another action",
+			bind:            func(c *controls) { c.bindKey(actionBomb, ebiten.KeyE) },
+			bombKeys:        []ebiten.Key{ebiten.KeyE},
+			bombButtons:     []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightBottom},
+			detonateButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightRight},
+		},
+		{
+			name:         "button of another action",
+			bind:         func(c *controls) { c.bindButton(actionBomb, ebiten.StandardGamepadButtonRightRight) },
+			bombKeys:     []ebiten.Key{ebiten.KeySpace},
+			detonateKeys: []ebiten.Key{ebiten.KeyE},
+			bombButtons:  []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightRight},
+		},
+		{
+			name:            "own key",
+			bind:            func(c *controls) { c.bindKey(actionDetonate, ebiten.KeyE) },
+			bombKeys:        []ebiten.Key{ebiten.KeySpace},
+			detonateKeys:    []ebiten.Key{ebiten.KeyE},
+			bombButtons:     []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightBottom},
+			detonateButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightRight},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newControls(defaultConfig(), 0)
+			tt.bind(c)
+			// the saved bindings read back, an action which lost its binding doesn't get the default again
+			b := c.bindings()
+			data, err := json.Marshal(&config{Players: []bindings{b}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := parseConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []*controls{c, newControls(cfg, 0)} {
+				if !reflect.DeepEqual(c.keys[actionBomb], tt.bombKeys) || !reflect.DeepEqual(c.keys[actionDetonate], tt.detonateKeys) {
+					t.Errorf("keys %v and %v, want %v and %v", c.keys[actionBomb], c.keys[actionDetonate], tt.bombKeys, tt.detonateKeys)
+				}
+				if !reflect.DeepEqual(c.buttons[actionBomb], tt.bombButtons) || !reflect.DeepEqual(c.buttons[actionDetonate], tt.detonateButtons) {
+					t.Errorf("buttons %v and %v, want %v and %v", c.buttons[actionBomb], c.buttons[actionDetonate], tt.bombButtons, tt.detonateButtons)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"strings"
+	"time"
+)
+
+const (
+	// kills stay in the feed for killFeedTime, and fade out in the last killFeedFade
+	killFeedTime = 6 * time.Second
+	killFeedFade = 2 * time.Second
+	killFeedSize = 5
+)
+
+// kill is an entry of the kill feed
+type kill struct {
+	killer, pusher, victim string
+	at                     time.Time
+}
+
+func (k kill) String() string {
+	if k.pusher != "" && k.pusher != k.killer {
+		// the pusher helped
+		killer := k.killer
+		if killer == "random" {
+			killer = "random bomb"
+		}
+		return killer + "+" + k.pusher + " -> " + k.victim
+	}
+	switch k.killer {
+	case "":
+		return k.victim + " died"
+	case k.victim:
+		return k.victim + " blew up"
+	case "random":
+		return "random bomb -> " + k.victim
+	default:
+		return k.killer + " -> " + k.victim
+	}
+}
+
+// addKill put a death to the kill feed, the oldest kills are dropped
+func (g *Game) addKill(killer, pusher, victim string) {
+	now := time.Now()
+	feed := g.killFeed[:0]
+	for _, k := range g.killFeed {
+		if now.Sub(k.at) < killFeedTime {
+			feed = append(feed, k)
+		}
+	}
+	feed = append(feed, kill{killer: killer, pusher: pusher, victim: victim, at: now})
+	if len(feed) > killFeedSize {
+		feed = feed[len(feed)-killFeedSize:]
+	}
+	g.killFeed = feed
+}
+
+// deathRecap tells a local player how it died
+type deathRecap struct {
+	bombName string
+	// the player who set the bomb
+	placer string
+	// every player who pushed the bomb, in order
+	pushers []string
+}
+
+func newDeathRecap(bomb *Bomb) *deathRecap {
+	return &deathRecap{
+		bombName: bomb.bombName,
+		placer:   bomb.playerName,
+		// the bomb may be pushed again after the death
+		pushers: append([]string(nil), bomb.pushers...),
+	}
+}
+
+func (d *deathRecap) String() string {
+	placer := "set by " + d.placer
+	if d.placer == "random" {
+		placer = "a random bomb"
+	}
+	pushed := "not pushed"
+	if len(d.pushers) > 0 {
+		pushed = "pushed by " + strings.Join(d.pushers, ", ")
+	}
+	return fmt.Sprintf("killed by %s, %s, %s", d.bombName, placer, pushed)
+}
+
+// drawKillFeed print the recent kills at the top right of the screen, they fade out before disappearing
+func (r *renderer) drawKillFeed(g *Game, screen *ebiten.Image) {
+	if r.textLayer == nil {
+		r.textLayer = ebiten.NewImage(screenWidth, debugCharHeight)
+	}
+	now := time.Now()
+	y := 0
+	for _, k := range g.killFeed {
+		age := now.Sub(k.at)
+		if age > killFeedTime {
+			continue
+		}
+		alpha := 1.0
+		if fade := killFeedTime - age; fade < killFeedFade {
+			alpha = float64(fade) / float64(killFeedFade)
+		}
+		text := k.String()
+		r.textLayer.Clear()
+		ebitenutil.DebugPrint(r.textLayer, text)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(viewWidth-len(text)*debugCharWidth-4), float64(y))
+		op.ColorM.Scale(1, 1, 1, alpha)
+		screen.DrawImage(r.textLayer, op)
+		y += debugCharHeight
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// localPlayer is a player playing on this client, every local player
+// has its own bindings, view and HUD area
+type localPlayer struct {
+	name string
+	// index of the bindings in config.Players
+	index int
+	// move the player when direction keys are held
+	mover *mover
+	// keyboard and gamepad of the player
+	controls *controls
+	rebinder rebinder
+	// follow the player in its viewport
+	camera camera
+	// how the player died the last time
+	recap *deathRecap
+}
+
+// rebindKey of the local player, F1 for the first player, F2 for the second...
+func (lp *localPlayer) rebindKey() ebiten.Key {
+	return ebiten.KeyF1 + ebiten.Key(lp.index)
+}
+
+// localPlayer find a local player by name, nil for remote players
+func (g *Game) localPlayer(name string) *localPlayer {
+	for _, lp := range g.localPlayers {
+		if lp.name == name {
+			return lp
+		}
+	}
+	return nil
+}
+
+// controlledNames are the names of the local players, the bots and the agents of this client
+func (g *Game) controlledNames() []string {
+	names := make([]string, 0, len(g.localPlayers)+len(g.bots)+len(g.agents))
+	for _, lp := range g.localPlayers {
+		names = append(names, lp.name)
+	}
+	for _, b := range g.bots {
+		names = append(names, b.name)
+	}
+	for _, a := range g.agents {
+		names = append(names, a.name)
+	}
+	return names
+}
+
+// ownsBomb reports whether this client times the bomb, which is true
+// for bombs of local players, bots, agents and random bombs, unless the room has a server
+func (g *Game) ownsBomb(bombName string) bool {
+	if g.remote {
+		// the server times every bomb
+		return false
+	}
+	if strings.HasPrefix(bombName, "random-") {
+		return true
+	}
+	for _, name := range g.controlledNames() {
+		if strings.HasPrefix(bombName, name+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// updateLocalPlayer read the input of a local player and send its events,
+// the player doesn't act while someone types in the chat
+func (g *Game) updateLocalPlayer(lp *localPlayer, typing bool) {
+	lp.controls.update()
+	// no action while rebinding keys
+	acting := !lp.rebinder.active && !typing
+	switch {
+	case typing:
+		// the keys are typed into the chat
+	case lp.rebinder.active:
+		if lp.rebinder.update(lp.controls) {
+			if err := lp.controls.saveTo(g.config, lp.index); err != nil {
+				log.Error("[updateLocalPlayer] save config ", err)
+			}
+		}
+	case inpututil.IsKeyJustPressed(lp.rebindKey()):
+		lp.rebinder.start()
+		acting = false
+	}
+
+	var in intent
+	if acting {
+		in.held, in.pressed = lp.controls.directions()
+		in.bomb = lp.controls.justPressed(actionBomb)
+		in.detonate = lp.controls.justPressed(actionDetonate)
+		in.revive = lp.controls.justPressed(actionRevive)
+	}
+	if killer := g.act(lp.name, lp.mover, in); killer != nil {
+		lp.recap = newDeathRecap(killer)
+	}
+
+	lp.camera.follow(g.nameToPlayers[lp.name].pos, g.size)
+}
@@ -1,15 +1,211 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/sirupsen/logrus"
 	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 const pulsarUrl = "pulsar://localhost:6650"
 
 func main() {
+	// several local players share the client, e.g. -name alice,bob
+	playerNames := flag.String("name", "testName2", "comma separated names of the local players")
+	roomName := flag.String("room", "roomName", "room name")
+	speed := flag.Float64("speed", defaultSpeed, "cells per second when holding a direction key, at most the speed of the room")
+	avatars := flag.String("avatar", defaultAvatar, "comma separated skins of the local players, one of "+strings.Join(avatarNames(), ", "))
+	// maps are looked up in mapDir, e.g. -map classic
+	mapName := flag.String("map", "", "map name, empty for generated obstacles")
+	generator := flag.String("generator", defaultGenerator, "obstacle generator: random, classic, symmetric, maze or cave")
+	seed := flag.Int64("seed", 0, "seed of the obstacle generator, 0 for a new map every time")
+	width := flag.Int("width", xGridCountInScreen, "width of generated or new edited maps in grids")
+	height := flag.Int("height", yGridCountInScreen, "height of generated or new edited maps in grids")
+	edit := flag.Bool("edit", false, "open the map editor for -map")
+	// bots are named after the first player, e.g. testName2Bot1
+	bots := flag.String("bots", "", "comma separated difficulties of bots playing on this client: "+strings.Join(difficultyNames(), ", "))
+	headless := flag.Bool("headless", false, "run only the bots of -bots without a window, -name names them")
+	// e.g. -tournament 100 -bots easy,normal,hard -report report.json
+	tournament := flag.Int("tournament", 0, "run this many bot matches between the difficulties of -bots offline, and report the results")
+	report := flag.String("report", "", "tournament report file, json if it ends with .json, otherwise csv; stdout if empty")
+	// a room with a server: go run . -server -room r, then go run . -remote -room r -name alice
+	server := flag.Bool("server", false, "run the authoritative server of -room without a window, players move at -speed")
+	remote := flag.Bool("remote", false, "join a room with a server, which plays the players of this client from their inputs")
+	// scores are counted by a client of the room, or by a standalone scorer
+	scorer := flag.Bool("scorer", false, "run the scorer of -room without a window, with -remote for a room with a server")
+	profileName := flag.String("profile", "", "print the profile of this player and exit")
+	gym := flag.Bool("gym", false, "serve the reinforcement learning environment over stdin and stdout, a json request per line")
+	// the connection flags override the connection of the config file
+	url := flag.String("url", "", "pulsar service url, "+pulsarUrl+" if the config file has none")
+	token := flag.String("token", "", "log in with this token, the player is named after its subject")
+	tokenFile := flag.String("token-file", "", "log in with the token in this file")
+	oauth2Issuer := flag.String("oauth2-issuer", "", "log in with oauth2 client credentials from this issuer url")
+	oauth2Key := flag.String("oauth2-key", "", "json file of the oauth2 client id and secret")
+	oauth2Audience := flag.String("oauth2-audience", "", "audience of the oauth2 token")
+	oauth2Scope := flag.String("oauth2-scope", "", "scope of the oauth2 token")
+	// e.g. -url pulsar+ssl://localhost:6651 -tls-trust-certs ca.cert.pem
+	tlsTrustCerts := flag.String("tls-trust-certs", "", "file of the certificates trusted to sign the certificate of the broker")
+	tlsCert := flag.String("tls-cert", "", "client certificate file, to log in with the certificate when there is no token")
+	tlsKey := flag.String("tls-key", "", "private key file of -tls-cert")
+	keyNamespace := flag.String("key-namespace", "", "tenant/namespace of the key topics of the players, the default namespace if empty")
+	flag.Parse()
+	if *width < 1 || *width > maxMapLength || *height < 1 || *height > maxMapLength {
+		log.Fatalf("[main] -width and -height must be from 1 to %d", maxMapLength)
+	}
+	// connection of the config file overridden by the command line
+	connection := func(cfg *config) connectionConfig {
+		conn := cfg.Connection
+		if *url != "" {
+			conn.URL = *url
+		}
+		if *token != "" || *tokenFile != "" || *oauth2Issuer != "" {
+			conn.Token = *token
+			conn.TokenFile = *tokenFile
+			conn.OAuth2 = nil
+			if *oauth2Issuer != "" {
+				conn.OAuth2 = &oauth2Config{
+					IssuerURL:  *oauth2Issuer,
+					PrivateKey: *oauth2Key,
+					Audience:   *oauth2Audience,
+					Scope:      *oauth2Scope,
+				}
+			}
+		}
+		if *tlsTrustCerts != "" {
+			conn.TLSTrustCertsFile = *tlsTrustCerts
+		}
+		if *tlsCert != "" || *tlsKey != "" {
+			conn.TLSCertFile = *tlsCert
+			conn.TLSKeyFile = *tlsKey
+		}
+		if *keyNamespace != "" {
+			conn.KeyNamespace = *keyNamespace
+		}
+		if err := conn.validate(); err != nil {
+			log.Fatal("[main] ", err)
+		}
+		return conn
+	}
+
+	if *gym {
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Fatal("[main] load config ", err)
+		}
+		// stdout is the protocol, only warnings go to stderr
+		logrus.SetLevel(logrus.WarnLevel)
+		if err = runGym(os.Stdin, os.Stdout, cfg); err != nil {
+			log.Fatal("[main] gym ", err)
+		}
+		return
+	}
+
+	if *server {
+		if _, ok := mapGenerators[*generator]; !ok {
+			log.Fatal("[main] unknown generator ", *generator)
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Fatal("[main] load config ", err)
+		}
+		game := newServer(*roomName, roomOptions{
+			connection: connection(cfg),
+			mapName:    *mapName,
+			generator:  *generator,
+			seed:       *seed,
+			size:       mapSize{width: *width, height: *height},
+			speed:      *speed,
+			scoring:    cfg.Scoring,
+		}, cfg)
+		defer game.Close()
+		runHeadless(game)
+		return
+	}
+
+	if *scorer {
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Fatal("[main] load config ", err)
+		}
+		newScorerClient(*roomName, connection(cfg), *remote).runScorer(cfg.Scoring)
+		return
+	}
+
+	if *profileName != "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Fatal("[main] load config ", err)
+		}
+		client, err := connection(cfg).newClient()
+		if err != nil {
+			log.Fatal("[main] ", err)
+		}
+		defer client.Close()
+		c := &pulsarClient{client: client}
+		c.readProfiles()
+		defer c.profileTable.Close()
+		p, ok := c.profile(*profileName)
+		if !ok {
+			fmt.Println(*profileName, "has no profile yet")
+			return
+		}
+		fmt.Println(p)
+		return
+	}
+
+	if *tournament > 0 {
+		strategies := strings.Split(*bots, ",")
+		for _, level := range strategies {
+			if _, ok := difficulties[level]; !ok {
+				log.Fatal("[main] unknown bot difficulty ", level)
+			}
+		}
+		if len(strategies) < 2 {
+			log.Fatal("[main] a tournament needs at least two bots")
+		}
+		if _, ok := mapGenerators[*generator]; !ok {
+			log.Fatal("[main] unknown generator ", *generator)
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Fatal("[main] load config ", err)
+		}
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		// events of simulated games are not worth logging
+		logrus.SetLevel(logrus.WarnLevel)
+		result := runTournament(tournamentOptions{
+			matches:    *tournament,
+			strategies: strategies,
+			generator:  *generator,
+			size:       mapSize{width: *width, height: *height},
+			seed:       *seed,
+		}, cfg)
+		if err = result.write(*report); err != nil {
+			log.Fatal("[main] write report ", err)
+		}
+		return
+	}
+
 	ebiten.SetWindowSize(screenWidth, screenHeight)
+	if *edit {
+		ebiten.SetWindowTitle("Bomb man map editor")
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Fatal("[main] load config ", err)
+		}
+		editor := newEditor(*mapName, *roomName, mapSize{width: *width, height: *height}, connection(cfg))
+		if err = ebiten.RunGame(editor); err != nil {
+			log.Fatal("[main]", err)
+		}
+		return
+	}
 	ebiten.SetWindowTitle("Bomb man")
 	fmt.Println("input room name:")
 	//reader := bufio.NewReader(os.Stdin)
@@ -21,7 +217,100 @@ func main() {
 	//playerName = strings.Trim(playerName, "\n")
 	//playerName = strings.ReplaceAll(playerName, "-", "_")
 
-	game := newGame("testName2", "roomName")
+	if _, ok := mapGenerators[*generator]; !ok {
+		log.Fatal("[main] unknown generator ", *generator)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal("[main] load config ", err)
+	}
+	conn := connection(cfg)
+	names := strings.Split(*playerNames, ",")
+	if len(names) > maxLocalPlayers {
+		log.Fatal("[main] at most ", maxLocalPlayers, " local players")
+	}
+	if conn.authenticated() {
+		// the player logs in as the subject of its token, nobody can take its name
+		subject, err := conn.subject()
+		if err != nil {
+			log.Fatal("[main] log in ", err)
+		}
+		if len(names) > 1 {
+			log.Fatal("[main] a logged in client has one local player")
+		}
+		if err = validPlayerName(subject); err != nil {
+			log.Fatal("[main] the subject is not a player name: ", err)
+		}
+		names = []string{subject}
+		log.Println("[main] playing as", names[0])
+	}
+	botPrefix := names[0]
+	if *headless {
+		names = nil
+	}
+	avatarList := strings.Split(*avatars, ",")
+	var players []playerOptions
+	for i, name := range names {
+		if err := validPlayerName(name); err != nil {
+			log.Fatal("[main] invalid player name: ", err)
+		}
+		// players without an avatar get the last one
+		avatar := avatarList[len(avatarList)-1]
+		if i < len(avatarList) {
+			avatar = avatarList[i]
+		}
+		if _, ok := skins[avatar]; !ok {
+			log.Fatal("[main] unknown avatar ", avatar)
+		}
+		players = append(players, playerOptions{
+			name:   name,
+			avatar: avatar,
+			speed:  *speed,
+		})
+	}
+	var botPlayers []playerOptions
+	if *bots != "" {
+		for i, level := range strings.Split(*bots, ",") {
+			if _, ok := difficulties[level]; !ok {
+				log.Fatal("[main] unknown bot difficulty ", level)
+			}
+			botPlayers = append(botPlayers, playerOptions{
+				name:   fmt.Sprintf("%sBot%d", botPrefix, i+1),
+				avatar: avatarNames()[i%len(skins)],
+				bot:    level,
+			})
+		}
+	}
+	if len(players) == 0 && len(botPlayers) == 0 {
+		log.Fatal("[main] no player, -headless needs -bots")
+	}
+	options := roomOptions{
+		connection: conn,
+		mapName:    *mapName,
+		generator:  *generator,
+		seed:       *seed,
+		size:       mapSize{width: *width, height: *height},
+		speed:      *speed,
+		scoring:    cfg.Scoring,
+	}
+
+	// every bot joins the room as a client of its own, with its own subscription
+	var wg sync.WaitGroup
+	for _, bot := range botPlayers {
+		botGame := newGame([]playerOptions{bot}, *roomName, options, cfg, *remote)
+		defer botGame.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runHeadless(botGame)
+		}()
+	}
+	if *headless {
+		wg.Wait()
+		return
+	}
+
+	game := newGame(players, *roomName, options, cfg, *remote)
 	defer game.Close()
 
 	//game.randomBombsEnable()
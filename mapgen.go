@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// mapGenerator build walls of a width x height grid, true means a wall
+type mapGenerator func(rng *rand.Rand, width, height int) [][]bool
+
+var mapGenerators = map[string]mapGenerator{
+	"random":    randomWalls,
+	"classic":   classicWalls,
+	"symmetric": symmetricWalls,
+	"maze":      mazeWalls,
+	"cave":      caveWalls,
+}
+
+const defaultGenerator = "random"
+
+// generateMap build a map with the named generator, the same seed always builds the same map.
+// Every cell which is not a wall is reachable from every spawn point,
+// destructible blocks are passable since they can be bombed.
+func generateMap(generator string, seed int64, width, height int) (*GameMap, error) {
+	gen, ok := mapGenerators[generator]
+	if !ok {
+		return nil, fmt.Errorf("unknown map generator %q", generator)
+	}
+	if width < 1 || width > maxMapLength || height < 1 || height > maxMapLength {
+		return nil, fmt.Errorf("invalid map size %dx%d", width, height)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	walls := gen(rng, width, height)
+	connectWalls(walls)
+
+	m := &GameMap{
+		Name:      fmt.Sprintf("%s-%d", generator, seed),
+		Width:     width,
+		Height:    height,
+		Generator: generator,
+		Seed:      seed,
+	}
+	// spawn at the free cells nearest to the corners and the center
+	spawns := map[Position]bool{}
+	for _, p := range []Position{
+		{X: 0, Y: 0},
+		{X: width - 1, Y: 0},
+		{X: 0, Y: height - 1},
+		{X: width - 1, Y: height - 1},
+		{X: width / 2, Y: height / 2},
+	} {
+		spawn := nearestFree(walls, p)
+		if !spawns[spawn] {
+			spawns[spawn] = true
+			m.Spawns = append(m.Spawns, spawn)
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := Position{X: x, Y: y}
+			if walls[y][x] {
+				m.Walls = append(m.Walls, p)
+				continue
+			}
+			if nearSpawn(m.Spawns, p) {
+				// players need some room to escape from their first bomb
+				continue
+			}
+			if rng.Intn(destructibleObstacleRatio) == 0 {
+				m.Blocks = append(m.Blocks, p)
+			}
+		}
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func newWallGrid(width, height int) [][]bool {
+	walls := make([][]bool, height)
+	for y := range walls {
+		walls[y] = make([]bool, width)
+	}
+	return walls
+}
+
+// randomWalls sample walls uniformly
+func randomWalls(rng *rand.Rand, width, height int) [][]bool {
+	walls := newWallGrid(width, height)
+	for _, code := range rng.Perm(width * height)[:width*height/indestructibleObstacleRatio] {
+		walls[code/width][code%width] = true
+	}
+	return walls
+}
+
+// classicWalls is the pillar grid of Bomberman
+func classicWalls(rng *rand.Rand, width, height int) [][]bool {
+	walls := newWallGrid(width, height)
+	for y := 1; y < height; y += 2 {
+		for x := 1; x < width; x += 2 {
+			walls[y][x] = true
+		}
+	}
+	return walls
+}
+
+// symmetricWalls sample walls in the top left quarter and mirror them
+func symmetricWalls(rng *rand.Rand, width, height int) [][]bool {
+	walls := newWallGrid(width, height)
+	for y := 0; y < (height+1)/2; y++ {
+		for x := 0; x < (width+1)/2; x++ {
+			if rng.Intn(5) != 0 {
+				continue
+			}
+			walls[y][x] = true
+			walls[y][width-1-x] = true
+			walls[height-1-y][x] = true
+			walls[height-1-y][width-1-x] = true
+		}
+	}
+	return walls
+}
+
+// mazeWalls carve a maze by random DFS, then remove some walls to make loops,
+// a perfect maze has no place to hide from flames
+func mazeWalls(rng *rand.Rand, width, height int) [][]bool {
+	walls := newWallGrid(width, height)
+	for y := range walls {
+		for x := range walls[y] {
+			walls[y][x] = true
+		}
+	}
+	start := Position{X: 0, Y: 0}
+	walls[0][0] = false
+	stack := []Position{start}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		var nexts []Position
+		for _, d := range []Position{{X: 2}, {X: -2}, {Y: 2}, {Y: -2}} {
+			next := Position{X: cur.X + d.X, Y: cur.Y + d.Y}
+			if next.X >= 0 && next.Y >= 0 && next.X < width && next.Y < height && walls[next.Y][next.X] {
+				nexts = append(nexts, next)
+			}
+		}
+		if len(nexts) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		next := nexts[rng.Intn(len(nexts))]
+		walls[(cur.Y+next.Y)/2][(cur.X+next.X)/2] = false
+		walls[next.Y][next.X] = false
+		stack = append(stack, next)
+	}
+	for y := range walls {
+		for x := range walls[y] {
+			if walls[y][x] && rng.Intn(3) == 0 {
+				walls[y][x] = false
+			}
+		}
+	}
+	return walls
+}
+
+// caveWalls is a cellular automaton, a cell becomes a wall if most of its neighbours are walls
+func caveWalls(rng *rand.Rand, width, height int) [][]bool {
+	walls := newWallGrid(width, height)
+	for y := range walls {
+		for x := range walls[y] {
+			walls[y][x] = rng.Intn(100) < 40
+		}
+	}
+	for i := 0; i < 4; i++ {
+		next := newWallGrid(width, height)
+		for y := range walls {
+			for x := range walls[y] {
+				count := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := x+dx, y+dy
+						// border counts as wall
+						if nx < 0 || ny < 0 || nx >= width || ny >= height || walls[ny][nx] {
+							count++
+						}
+					}
+				}
+				next[y][x] = count >= 5
+			}
+		}
+		walls = next
+	}
+	return walls
+}
+
+// connectWalls remove walls until all free cells are connected
+func connectWalls(walls [][]bool) {
+	height, width := len(walls), len(walls[0])
+	for {
+		regions := freeRegions(walls)
+		if len(regions) <= 1 {
+			if len(regions) == 0 {
+				// no free cell at all
+				walls[0][0] = false
+			}
+			return
+		}
+		// connect the smallest region to any other region,
+		// BFS through walls and break the walls on the way
+		sort.Slice(regions, func(i, j int) bool { return len(regions[i]) < len(regions[j]) })
+		inRegion := map[Position]bool{}
+		for _, p := range regions[0] {
+			inRegion[p] = true
+		}
+		from := map[Position]Position{}
+		queue := append([]Position{}, regions[0]...)
+		for _, p := range queue {
+			from[p] = p
+		}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			if !walls[cur.Y][cur.X] && !inRegion[cur] {
+				// reach another region, break walls on the path
+				for p := from[cur]; !inRegion[p]; p = from[p] {
+					walls[p.Y][p.X] = false
+				}
+				break
+			}
+			for _, next := range neighbours(cur) {
+				if next.X < 0 || next.Y < 0 || next.X >= width || next.Y >= height {
+					continue
+				}
+				if _, ok := from[next]; ok {
+					continue
+				}
+				from[next] = cur
+				queue = append(queue, next)
+			}
+		}
+	}
+}
+
+// freeRegions group the free cells by connectivity
+func freeRegions(walls [][]bool) [][]Position {
+	height, width := len(walls), len(walls[0])
+	visited := map[Position]bool{}
+	var regions [][]Position
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			start := Position{X: x, Y: y}
+			if walls[y][x] || visited[start] {
+				continue
+			}
+			visited[start] = true
+			region := []Position{start}
+			for i := 0; i < len(region); i++ {
+				for _, next := range neighbours(region[i]) {
+					if next.X < 0 || next.Y < 0 || next.X >= width || next.Y >= height ||
+						walls[next.Y][next.X] || visited[next] {
+						continue
+					}
+					visited[next] = true
+					region = append(region, next)
+				}
+			}
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+func neighbours(p Position) []Position {
+	return []Position{
+		{X: p.X - 1, Y: p.Y},
+		{X: p.X + 1, Y: p.Y},
+		{X: p.X, Y: p.Y - 1},
+		{X: p.X, Y: p.Y + 1},
+	}
+}
+
+// nearestFree find the free cell nearest to p
+func nearestFree(walls [][]bool, p Position) Position {
+	best, bestDist := p, -1
+	for y := range walls {
+		for x := range walls[y] {
+			if walls[y][x] {
+				continue
+			}
+			dist := abs(x-p.X) + abs(y-p.Y)
+			if bestDist < 0 || dist < bestDist {
+				best, bestDist = Position{X: x, Y: y}, dist
+			}
+		}
+	}
+	return best
+}
+
+func nearSpawn(spawns []Position, p Position) bool {
+	for _, s := range spawns {
+		if abs(s.X-p.X)+abs(s.Y-p.Y) <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
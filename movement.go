@@ -0,0 +1,148 @@
+package main
+
+import "time"
+
+const (
+	// cells per second a player moves when holding a direction
+	defaultSpeed = 6.0
+	maxSpeed     = 15.0
+	// a direction pressed before the player reaches an intersection is kept for inputBufferTime,
+	// so the player turns as soon as the way is open
+	inputBufferTime = 250 * time.Millisecond
+	// don't send a new move until the last one comes back from pulsar, or moveEchoTimeout passed
+	moveEchoTimeout = 300 * time.Millisecond
+)
+
+// mover turns held directions into moves of a player at its speed
+type mover struct {
+	// cells per second, at most limit when the room has a speed
+	speed float64
+	limit float64
+	// cells per second added to speed by power-ups during play
+	bonus      float64
+	lastMoveAt time.Time
+
+	// the direction pressed most recently, it wins when several directions are held
+	lastPressed Direction
+
+	buffered   Direction
+	bufferedAt time.Time
+
+	// the target of the last move sent
+	sentPos Position
+	pending bool
+}
+
+func newMover(speed float64) *mover {
+	return &mover{speed: clampSpeed(speed)}
+}
+
+// clampSpeed return a speed between 0 and maxSpeed, defaultSpeed for 0
+func clampSpeed(speed float64) float64 {
+	if speed <= 0 {
+		return defaultSpeed
+	}
+	if speed > maxSpeed {
+		return maxSpeed
+	}
+	return speed
+}
+
+// currentSpeed is the speed with the power-ups, at most maxSpeed and the speed of the room
+func (m *mover) currentSpeed() float64 {
+	speed := clampSpeed(m.speed + m.bonus)
+	if m.limit > 0 && m.limit < speed {
+		speed = m.limit
+	}
+	return speed
+}
+
+// upgradeSpeed add bonus cells per second to a player of this client, it returns false for other players
+func (g *Game) upgradeSpeed(name string, bonus float64) bool {
+	if lp := g.localPlayer(name); lp != nil {
+		lp.mover.bonus += bonus
+		return true
+	}
+	for _, b := range g.bots {
+		if b.name == name {
+			b.mover.bonus += bonus
+			return true
+		}
+	}
+	for _, a := range g.agents {
+		if a.name == name {
+			a.mover.bonus += bonus
+			return true
+		}
+	}
+	return false
+}
+
+// setRoomSpeed limit the players of this client to the speed of the room,
+// the other clients drop faster moves
+func (g *Game) setRoomSpeed(speed float64) {
+	g.roomSpeed = speed
+	for _, lp := range g.localPlayers {
+		lp.mover.limit = speed
+	}
+	for _, b := range g.bots {
+		b.mover.limit = speed
+	}
+	for _, a := range g.agents {
+		a.mover.limit = speed
+	}
+}
+
+// step decide the direction to move now, dirNone means stay.
+// held is the set of directions being held, pressed is the direction just pressed or dirNone.
+func (m *mover) step(g *Game, pos Position, held map[Direction]bool, pressed Direction, now time.Time) Direction {
+	if pressed != dirNone {
+		m.lastPressed = pressed
+		m.buffered = pressed
+		m.bufferedAt = now
+	}
+	if m.pending && pos != m.sentPos && now.Sub(m.lastMoveAt) < moveEchoTimeout {
+		// wait for the last move
+		return dirNone
+	}
+	m.pending = false
+	if now.Sub(m.lastMoveAt) < time.Duration(float64(time.Second)/m.currentSpeed()) {
+		return dirNone
+	}
+
+	var candidates []Direction
+	if m.buffered != dirNone && now.Sub(m.bufferedAt) < inputBufferTime {
+		candidates = append(candidates, m.buffered)
+	}
+	if held[m.lastPressed] {
+		candidates = append(candidates, m.lastPressed)
+	}
+	for _, dir := range []Direction{dirLeft, dirRight, dirDown, dirUp} {
+		if held[dir] {
+			candidates = append(candidates, dir)
+		}
+	}
+
+	for _, dir := range candidates {
+		next := g.size.getNextPosition(pos, dir)
+		if next == pos || g.blocked(next) {
+			continue
+		}
+		if dir == m.buffered {
+			m.buffered = dirNone
+		}
+		m.lastMoveAt = now
+		m.sentPos = next
+		m.pending = true
+		return dir
+	}
+	return dirNone
+}
+
+// blocked reports whether players cannot walk into pos
+func (g *Game) blocked(pos Position) bool {
+	g.obstacleLock.RLock()
+	defer g.obstacleLock.RUnlock()
+	_, ok := g.obstacleMap[pos]
+	return ok
+}
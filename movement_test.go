@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpgradeSpeed(t *testing.T) {
+	tests := []struct {
+		name   string
+		speed  float64
+		bonus  []float64
+		limit  float64
+		player string
+		want   float64
+	}{
+		{name: "no power-up", speed: 6, want: 6},
+		{name: "power-up", speed: 6, bonus: []float64{2}, want: 8},
+		{name: "power-ups add up", speed: 6, bonus: []float64{2, 3}, want: 11},
+		{name: "at most maxSpeed", speed: 6, bonus: []float64{5, 5}, want: maxSpeed},
+		{name: "at most the room", speed: 6, bonus: []float64{5}, limit: 8, want: 8},
+		{name: "another player", speed: 6, bonus: []float64{2}, player: "bob", want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGameState(defaultConfig(), newSimClock(), 1)
+			m := newMover(tt.speed)
+			g.localPlayers = []*localPlayer{{name: "alice", mover: m}}
+			if tt.limit > 0 {
+				g.setRoomSpeed(tt.limit)
+			}
+			player := tt.player
+			if player == "" {
+				player = "alice"
+			}
+			for _, bonus := range tt.bonus {
+				if ok := g.upgradeSpeed(player, bonus); ok != (player == "alice") {
+					t.Fatalf("upgraded %s %v", player, ok)
+				}
+			}
+			if speed := m.currentSpeed(); speed != tt.want {
+				t.Errorf("speed %v, want %v", speed, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradedMoverMovesSooner(t *testing.T) {
+	g := newGameState(defaultConfig(), newSimClock(), 1)
+	g.obstacleMap = map[Position]ObstacleType{}
+	m := newMover(4)
+	g.localPlayers = []*localPlayer{{name: "alice", mover: m}}
+	held := map[Direction]bool{dirRight: true}
+	start := time.Now()
+	pos := Position{X: 1, Y: 1}
+	if dir := m.step(g, pos, held, dirRight, start); dir != dirRight {
+		t.Fatalf("first step %v, want right", dir)
+	}
+	pos.X++
+	// a cell takes 250ms at 4 cells per second, 125ms at 8
+	soon := start.Add(150 * time.Millisecond)
+	if dir := m.step(g, pos, held, dirNone, soon); dir != dirNone {
+		t.Fatalf("moved %v after 150ms at 4 cells per second", dir)
+	}
+	g.upgradeSpeed("alice", 4)
+	if dir := m.step(g, pos, held, dirNone, soon); dir != dirRight {
+		t.Errorf("step %v after 150ms at 8 cells per second, want right", dir)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// reservedNames can't name a player: the server of a room plays as serverName,
+// and random bombs are named after "random"
+var reservedNames = map[string]bool{serverName: true, "random": true}
+
+// validPlayerName return why name can't name a player, nil if it can.
+// Names are part of topic and bomb names, bomb names are split at "-".
+func validPlayerName(name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+	if reservedNames[name] {
+		return fmt.Errorf("%q is reserved", name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.') {
+			return fmt.Errorf("%q has %q, names have letters, digits, _ and . only", name, r)
+		}
+	}
+	return nil
+}
+
+// intent is what a player wants to do in a tick, read from its controls or decided by a bot
+type intent struct {
+	// the directions being held and the direction just pressed
+	held    map[Direction]bool
+	pressed Direction
+
+	bomb, detonate, revive bool
+}
+
+// act send the events of what the player does in this tick.
+// If the player stands in a flame it dies, then the bomb of the flame is returned.
+func (g *Game) act(name string, m *mover, in intent) *Bomb {
+	if g.remote {
+		// the server decides
+		g.sendInput(name, in)
+		return nil
+	}
+	player := g.nameToPlayers[name]
+
+	info := &playerInfo{
+		name:   player.name,
+		pos:    player.pos,
+		avatar: player.avatar,
+		alive:  player.alive,
+	}
+
+	// hold a direction to keep moving
+	var dir = dirNone
+	if player.alive {
+		dir = m.step(g, player.pos, in.held, in.pressed, g.clock.Now())
+	}
+
+	var bomb = false
+	switch {
+	case in.bomb:
+		bomb = true
+	case in.detonate:
+		g.detonate(name)
+	case in.revive:
+		// revive
+		if g.gameMap != nil {
+			info.pos = g.randomSpawn()
+		}
+		event := &UserReviveEvent{
+			playerInfo: info,
+		}
+		g.sendAsync(event)
+	}
+
+	var killer *Bomb
+	g.flameLock.RLock()
+	if val, ok := g.flameMap[player.pos]; ok && val != nil && player.alive {
+		player.alive = false
+		killer = val
+		// dead due to boom
+		event := &UserDeadEvent{
+			playerInfo: info,
+			// the player who set the bomb
+			killer: val.playerName,
+			pusher: val.lastPusher(),
+		}
+		g.sendAsync(event)
+	}
+	g.flameLock.RUnlock()
+
+	if dir != dirNone && player.alive {
+		nextPlayerPos := g.size.getNextPosition(player.pos, dir)
+		info.pos = nextPlayerPos
+		event := &UserMoveEvent{
+			playerInfo: info,
+		}
+		g.sendAsync(event)
+		if bomb, ok := g.posToBombs[nextPlayerPos]; ok {
+			g.pushBomb(bomb, dir, name)
+		}
+	}
+
+	// set bomb on empty block
+	if _, ok := g.posToBombs[player.pos]; !ok && bomb {
+		event := &SetBombEvent{
+			bombName: info.name + "-" + randStringRunes(5),
+			pos:      player.pos,
+		}
+		g.sendAsync(event)
+	}
+	return killer
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// profiles of every room are kept in one compacted topic, keyed by player
+	profileTopicName = "player-profile-topic"
+	// the scorers of every room send their rounds to the round topic,
+	// the profile updater applies them to the profiles one by one
+	roundTopicName = "player-round-topic"
+	// the subscription of the profile updater to the round topic is exclusive,
+	// the profiles have one writer, and durable, a new updater goes on from the last round
+	profileUpdaterSubscription = "profile-updater"
+	// rating of a new player
+	initialRating = 1500
+	// the most rating points a player can win or lose in a round
+	eloK = 32
+	// how many players the leaderboard shows
+	leaderboardSize = 20
+)
+
+// profile of a player over every game
+type profile struct {
+	Name   string  `json:"name"`
+	Kills  int     `json:"kills"`
+	Deaths int     `json:"deaths"`
+	Wins   int     `json:"wins"`
+	Rounds int     `json:"rounds"`
+	Rating float64 `json:"rating"`
+	// the sequence number of the last round applied to the profile,
+	// older rounds and the same round again are not applied
+	RoundSequence int64 `json:"roundSequence,omitempty"`
+}
+
+func (p *profile) String() string {
+	return fmt.Sprintf("%s: rating %.0f, %d wins in %d rounds, %d kills, %d deaths",
+		p.Name, p.Rating, p.Wins, p.Rounds, p.Kills, p.Deaths)
+}
+
+// readProfiles follow the profiles of every player
+func (c *pulsarClient) readProfiles() {
+	var err error
+	c.profileTable, err = c.newProfileTable()
+	if err != nil {
+		log.Fatal("[readProfiles]", err)
+	}
+	err = c.profileTable.ForEachAndListen(func(string, interface{}) error {
+		// the leaderboard is drawn again
+		c.profileVersion.Add(1)
+		return nil
+	})
+	if err != nil {
+		log.Fatal("[readProfiles]", err)
+	}
+}
+
+func (c *pulsarClient) newProfileTable() (pulsar.TableView, error) {
+	return c.client.CreateTableView(pulsar.TableViewOptions{
+		Topic:           profileTopicName,
+		Schema:          pulsar.NewStringSchema(nil),
+		SchemaValueType: reflect.TypeOf(""),
+	})
+}
+
+// profile of a player, a new profile if the player never played a round
+func (c *pulsarClient) profile(name string) (*profile, bool) {
+	return readProfile(c.profileTable, name)
+}
+
+func readProfile(table pulsar.TableView, name string) (*profile, bool) {
+	p := &profile{Name: name, Rating: initialRating}
+	v := table.Get(name)
+	if v == nil {
+		return p, false
+	}
+	if err := json.Unmarshal([]byte(*v.(*string)), p); err != nil {
+		log.Error("[profile]", err)
+		return p, false
+	}
+	return p, true
+}
+
+// profiles of every player, the best rating first
+func (c *pulsarClient) profiles() []*profile {
+	var profiles []*profile
+	for _, name := range c.profileTable.Keys() {
+		if p, ok := c.profile(name); ok {
+			profiles = append(profiles, p)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].Rating != profiles[j].Rating {
+			return profiles[i].Rating > profiles[j].Rating
+		}
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// round is what the scorer of a room counts on one map, a round ends when the map changes.
+// The scorer signs it, the profile updater applies the rounds of every room.
+type round struct {
+	Room string `json:"room"`
+	// the players who sent an event in the round
+	Players map[string]bool `json:"players"`
+	// points, kills and deaths of the round
+	Points map[string]int `json:"points"`
+	Kills  map[string]int `json:"kills"`
+	Deaths map[string]int `json:"deaths"`
+}
+
+func newRound(room string) *round {
+	return &round{
+		Room:    room,
+		Players: map[string]bool{},
+		Points:  map[string]int{},
+		Kills:   map[string]int{},
+		Deaths:  map[string]int{},
+	}
+}
+
+// death count the death of victim in the round
+func (r *round) death(rules scoreRules, victim, placer, pusher string) {
+	r.Players[victim] = true
+	r.Deaths[victim]++
+	if killer, _ := rules.killer(victim, placer, pusher); killer != "" && killer != victim {
+		r.Kills[killer]++
+	}
+	for name, p := range rules.credit(victim, placer, pusher) {
+		r.Points[name] += p
+	}
+}
+
+// eloUpdate return the rating change of every player of a round. Every pair of players
+// is a game won by the one with more points, and a player can win or lose eloK in a round.
+func eloUpdate(ratings map[string]float64, points map[string]int) map[string]float64 {
+	changes := map[string]float64{}
+	if len(ratings) < 2 {
+		return changes
+	}
+	k := eloK / float64(len(ratings)-1)
+	for a := range ratings {
+		for b := range ratings {
+			if a == b {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[b]-ratings[a])/400))
+			actual := 0.5
+			if points[a] > points[b] {
+				actual = 1
+			} else if points[a] < points[b] {
+				actual = 0
+			}
+			changes[a] += k * (actual - expected)
+		}
+	}
+	return changes
+}
+
+// endRound send a round signed by the scorer to the profile updater, rounds of one player don't count
+func (c *pulsarClient) endRound(producer pulsar.Producer, r *round) error {
+	if len(r.Players) < 2 {
+		return nil
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = producer.Send(context.Background(), &pulsar.ProducerMessage{
+		Payload:    value,
+		Properties: c.signValue(c.signer, value),
+	})
+	return err
+}
+
+// verifyRound check the signature of a round and return its sequence number. The scorer of a room
+// is one of its clients, so a round is signed by one of its players, or by the server
+// or the standalone scorer of its room.
+func (c *pulsarClient) verifyRound(r *round, properties map[string]string, value []byte) (int64, error) {
+	sender := properties[senderProperty]
+	if !r.Players[sender] && sender != r.Room+"-"+serverName && sender != r.Room+"-"+scorerName {
+		return 0, fmt.Errorf("%q can't send a round of %s", sender, r.Room)
+	}
+	return c.verifySignature(r.Room, properties, value)
+}
+
+// playRound return the profiles of the players of a round after it, profiles holds
+// their profiles before it. The player with the most points wins the round.
+// Nothing changes if a profile has the round with this sequence number or a later one.
+func playRound(profiles map[string]*profile, r *round, sequence int64) []*profile {
+	ratings := map[string]float64{}
+	best, winner := math.MinInt, ""
+	for name := range r.Players {
+		if profiles[name].RoundSequence >= sequence {
+			return nil
+		}
+		ratings[name] = profiles[name].Rating
+		if points := r.Points[name]; points > best {
+			best, winner = points, name
+		} else if points == best {
+			// a draw
+			winner = ""
+		}
+	}
+	changes := eloUpdate(ratings, r.Points)
+	var played []*profile
+	for name := range r.Players {
+		p := *profiles[name]
+		p.Kills += r.Kills[name]
+		p.Deaths += r.Deaths[name]
+		p.Rounds++
+		if name == winner {
+			p.Wins++
+		}
+		p.Rating += changes[name]
+		p.RoundSequence = sequence
+		played = append(played, &p)
+	}
+	return played
+}
+
+// runProfileUpdater try to become the profile updater until it is, then apply the rounds
+// of every room to the profiles
+func (c *pulsarClient) runProfileUpdater() {
+	for {
+		consumeCh := make(chan pulsar.ConsumerMessage)
+		consumer, err := c.client.Subscribe(pulsar.ConsumerOptions{
+			Topic:            roundTopicName,
+			SubscriptionName: profileUpdaterSubscription,
+			Type:             pulsar.Exclusive,
+			MessageChannel:   consumeCh,
+		})
+		if err == nil {
+			// this client is the profile updater until it fails
+			log.Info("[runProfileUpdater] updating the profiles")
+			if err = c.updateProfiles(consumeCh); err != nil {
+				log.Error("[runProfileUpdater]", err)
+			}
+			consumer.Close()
+		}
+		time.Sleep(scorerRetryTime)
+	}
+}
+
+// updateProfiles apply the rounds received on consumeCh to the profiles of their players
+func (c *pulsarClient) updateProfiles(consumeCh chan pulsar.ConsumerMessage) error {
+	// read the profiles up to the last one of the previous updater
+	table, err := c.newProfileTable()
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+	producer, err := c.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:  profileTopicName,
+		Schema: pulsar.NewStringSchema(nil),
+		// the profiles of a round are flushed in one batch, stored all or none
+		BatchingMaxPublishDelay: time.Hour,
+	})
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	// the profiles sent, the table may not have them yet
+	sent := map[string]*profile{}
+	for cm := range consumeCh {
+		msg := cm.Message
+		r := newRound("")
+		if err = json.Unmarshal(msg.Payload(), r); err != nil {
+			log.Warning("[updateProfiles] drop a round: ", err)
+			cm.Ack(msg)
+			continue
+		}
+		sequence, err := c.verifyRound(r, msg.Properties(), msg.Payload())
+		if err != nil {
+			log.Warning("[updateProfiles] drop a round: ", err)
+			cm.Ack(msg)
+			continue
+		}
+		profiles := map[string]*profile{}
+		for name := range r.Players {
+			if p, ok := sent[name]; ok {
+				profiles[name] = p
+			} else {
+				profiles[name], _ = readProfile(table, name)
+			}
+		}
+		played := playRound(profiles, r, sequence)
+		var messages []*pulsar.ProducerMessage
+		for _, p := range played {
+			value, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, &pulsar.ProducerMessage{Key: p.Name, Value: string(value)})
+		}
+		if err = sendBatch(producer, messages); err != nil {
+			// not acked, the next updater applies it
+			return err
+		}
+		for _, p := range played {
+			sent[p.Name] = p
+		}
+		log.Infof("[updateProfiles] a round of %d players in %s", len(played), r.Room)
+		cm.Ack(msg)
+	}
+	return nil
+}
+
+// profileCommand parse a "/profile <name>" chat message, the name is the sender's if empty
+func profileCommand(text, sender string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || fields[0] != "/profile" || len(fields) > 2 {
+		return "", false
+	}
+	if len(fields) == 1 {
+		return sender, true
+	}
+	return fields[1], true
+}
+
+// showProfile print the profile of a player in the chat
+func (g *Game) showProfile(name string) {
+	if g.client == nil {
+		return
+	}
+	p, ok := g.client.profile(name)
+	if !ok {
+		g.chat.system("%s has no profile yet", name)
+		return
+	}
+	g.chat.system("%s", p)
+}
+
+// drawLeaderboard print the players with the best rating of every room over the view
+func (r *renderer) drawLeaderboard(g *Game, screen *ebiten.Image) {
+	ebitenutil.DrawRect(screen, 0, 0, viewWidth, viewHeight, scoreboardColor)
+	const format = "%4s %-14s %6s %5s %6s %5s %6s"
+	lines := []string{
+		fmt.Sprintf(format, "rank", "player", "rating", "wins", "rounds", "kills", "deaths"),
+	}
+	if g.client != nil {
+		if version := g.client.profileVersion.Load(); r.leaderboardVersion != version {
+			r.leaderboard = g.client.profiles()
+			r.leaderboardVersion = version
+		}
+		for i, p := range r.leaderboard {
+			if i >= leaderboardSize {
+				break
+			}
+			lines = append(lines, fmt.Sprintf(format, strconv.Itoa(i+1), truncate(p.Name, 14),
+				strconv.FormatFloat(p.Rating, 'f', 0, 64), strconv.Itoa(p.Wins), strconv.Itoa(p.Rounds),
+				strconv.Itoa(p.Kills), strconv.Itoa(p.Deaths)))
+		}
+	}
+	y := debugCharHeight
+	for _, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, debugCharWidth, y)
+		y += debugCharHeight
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPlayRound(t *testing.T) {
+	r := newRound("room1")
+	r.Players["alice"], r.Players["bob"], r.Players["carol"] = true, true, true
+	r.death(defaultScoreRules, "bob", "alice", "")
+	r.death(defaultScoreRules, "carol", "alice", "")
+	r.death(defaultScoreRules, "carol", "carol", "")
+	profiles := map[string]*profile{
+		"alice": {Name: "alice", Rating: initialRating},
+		"bob":   {Name: "bob", Rating: initialRating, Rounds: 3, Wins: 1},
+		"carol": {Name: "carol", Rating: initialRating},
+	}
+
+	played := map[string]*profile{}
+	for _, p := range playRound(profiles, r, 2) {
+		played[p.Name] = p
+	}
+	if len(played) != 3 {
+		t.Fatalf("%d profiles played, want 3", len(played))
+	}
+	alice, bob, carol := played["alice"], played["bob"], played["carol"]
+	if alice.Kills != 2 || alice.Wins != 1 || alice.Rounds != 1 {
+		t.Errorf("alice = %+v, want 2 kills and the win of a first round", alice)
+	}
+	if bob.Deaths != 1 || bob.Wins != 1 || bob.Rounds != 4 {
+		t.Errorf("bob = %+v, want 1 death, 1 win in 4 rounds", bob)
+	}
+	if carol.Deaths != 2 || carol.Kills != 0 {
+		t.Errorf("carol = %+v, want 2 deaths and no kill", carol)
+	}
+	if !(alice.Rating > bob.Rating && bob.Rating > carol.Rating) {
+		t.Errorf("ratings %v, %v, %v, want alice > bob > carol", alice.Rating, bob.Rating, carol.Rating)
+	}
+	if profiles["alice"].Rounds != 0 {
+		t.Error("playRound changed the profiles before the round")
+	}
+
+	again := map[string]*profile{"alice": alice, "bob": bob, "carol": carol}
+	for _, sequence := range []int64{2, 1} {
+		if played := playRound(again, r, sequence); played != nil {
+			t.Errorf("a round with the sequence number %d after 2 changed %d profiles", sequence, len(played))
+		}
+	}
+}
+
+func TestVerifyRound(t *testing.T) {
+	alice := testClient(t, false, false, "alice")
+	mallory := testClient(t, false, false, "mallory")
+	server := testClient(t, true, false, "room1-server")
+	updater := testClient(t, false, false, "updater")
+	for _, c := range []*pulsarClient{alice, mallory, server} {
+		for name, key := range c.publicKeys {
+			updater.publicKeys[name] = key
+		}
+		c.roomName = "room1"
+	}
+	r := newRound("room1")
+	r.Players["alice"], r.Players["bob"] = true, true
+	value, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		from *pulsarClient
+		// change the properties of the round
+		change func(properties map[string]string)
+		ok     bool
+	}{
+		{name: "a player of the round", from: alice, ok: true},
+		{name: "the server of the room", from: server, ok: true},
+		{name: "a player of another round", from: mallory},
+		{name: "unsigned", from: alice, change: func(p map[string]string) { delete(p, signatureProperty) }},
+		{name: "another sender", from: mallory, change: func(p map[string]string) { p[senderProperty] = "alice" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			properties := tt.from.signValue(tt.from.signer, value)
+			if tt.change != nil {
+				tt.change(properties)
+			}
+			if _, err := updater.verifyRound(r, properties, value); (err == nil) != tt.ok {
+				t.Errorf("verifyRound = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+
+	properties := alice.signValue("alice", value)
+	other := newRound("room2")
+	other.Players = r.Players
+	if _, err := updater.verifyRound(other, properties, value); err == nil {
+		t.Error("a round of room1 is verified as a round of room2")
+	}
+}
+
+func TestEloUpdate(t *testing.T) {
+	ratings := map[string]float64{"alice": 1500, "bob": 1500}
+	changes := eloUpdate(ratings, map[string]int{"alice": 2, "bob": 0})
+	if changes["alice"] != eloK/2 || changes["bob"] != -eloK/2 {
+		t.Errorf("changes = %v, want ±%d", changes, eloK/2)
+	}
+	changes = eloUpdate(ratings, map[string]int{"alice": 1, "bob": 1})
+	if changes["alice"] != 0 || changes["bob"] != 0 {
+		t.Errorf("changes of a draw = %v, want none", changes)
+	}
+	if changes = eloUpdate(map[string]float64{"alice": 1500}, nil); len(changes) != 0 {
+		t.Errorf("changes of one player = %v, want none", changes)
+	}
+}
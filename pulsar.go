@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"fmt"
 	"github.com/apache/pulsar-client-go/pulsar"
 	log "github.com/sirupsen/logrus"
 	"math"
-	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -45,6 +48,11 @@ const eventJsonSchemaDef = `
       "name": "Alive",
       "type": "boolean"
     },
+    {
+      "name": "Pusher",
+      "type": "string",
+      "default": ""
+    },
     {
       "name": "List",
 		"type": {
@@ -69,7 +77,9 @@ type EventMessage struct {
 	X       int    `json:"x"`
 	Y       int    `json:"y"`
 	Alive   bool   `json:"alive"`
-	List    []int  `json:"list"`
+	// Pusher is the player who pushed a bomb
+	Pusher string `json:"pusher"`
+	List   []int  `json:"list"`
 }
 
 type pulsarClient struct {
@@ -79,12 +89,62 @@ type pulsarClient struct {
 	consumer             pulsar.Consumer
 	tableView            pulsar.TableView
 	consumeCh            chan pulsar.ConsumerMessage
+	// chat messages have their own topic
+	chatProducer  pulsar.Producer
+	chatConsumer  pulsar.Consumer
+	chatConsumeCh chan pulsar.ConsumerMessage
+	// inputs of remote clients go to the server of the room through the input topic
+	inputProducer  pulsar.Producer
+	inputConsumer  pulsar.Consumer
+	inputConsumeCh chan pulsar.ConsumerMessage
+	// exclusive subscriptions of the other local players, nobody else logs in with their names
+	nameGuards []pulsar.Consumer
+	// this client is the server of the room
+	server bool
+	// the room has a server, only its events are trusted and it publishes the maps
+	remote bool
 	// exclude type
 	exclusiveObstacleConsumer pulsar.Consumer
 	// to read the latest obstacle graph
 	obstacleReader pulsar.Reader
 	// subscribe the obstacle topic,
 	closeCh chan struct{}
+	// the map selected by this room, nil means generated obstacles
+	gameMap *GameMap
+	// generator name and seed of generated obstacles, seed 0 means a new seed every time
+	generator string
+	seed      int64
+	// size of generated maps
+	size mapSize
+	// the rules published with the maps of this client
+	rules roomRules
+
+	// average round trip of the messages of this client, and the ping of every player
+	pingLock  sync.RWMutex
+	roundTrip time.Duration
+	pings     map[string]time.Duration
+
+	// every player of this client signs its messages with its key,
+	// the key of signer signs the messages which act for nobody of this client
+	privateKeys map[string]ed25519.PrivateKey
+	signer      string
+	// the last sequence number signed by this client
+	sequence atomic.Int64
+	// the keys of the senders, read from their key topics
+	keyLock    sync.Mutex
+	publicKeys map[string]ed25519.PublicKey
+	// when the senders without a key were looked up, they are not read again before unknownKeyRetry
+	unknownKeys map[string]time.Time
+	// keys read in the current second, to limit the readers opened by floods of new names
+	keyReads      int
+	keyReadsSince time.Time
+	// the namespace of the key topics, empty for the default one
+	keyNamespace string
+
+	// profiles of every player, keyed by name
+	profileTable pulsar.TableView
+	// increase when a profile changes, then the renderer reloads the leaderboard
+	profileVersion atomic.Int64
 }
 
 func (c *pulsarClient) getEventTopicName() string {
@@ -95,6 +155,32 @@ func (c *pulsarClient) getMapTopicName() string {
 	return c.roomName + "-map-topic"
 }
 
+func (c *pulsarClient) getScoreTopicName() string {
+	return c.roomName + "-score-topic"
+}
+
+func (c *pulsarClient) getChatTopicName() string {
+	return c.roomName + "-chat-topic"
+}
+
+func (c *pulsarClient) getInputTopicName() string {
+	return c.roomName + "-input-topic"
+}
+
+// the subscription of the input topic is exclusive, a room has one server
+func (c *pulsarClient) getInputSubscriptionName() string {
+	return c.roomName + "-server-input-sub"
+}
+
+// getServerProducerName name the event producer of the server, clients only trust its events
+func (c *pulsarClient) getServerProducerName() string {
+	return c.roomName + "-server"
+}
+
+func (c *pulsarClient) getChatSubscriptionName() string {
+	return c.playerName + "-chat-sub"
+}
+
 func (c *pulsarClient) getEventSubscriptionName() string {
 	return c.playerName + "-event-sub"
 }
@@ -110,26 +196,59 @@ func (c *pulsarClient) getUniqueMapSubscriptionName() string {
 func (c *pulsarClient) Close() {
 	c.producer.Close()
 	c.consumer.Close()
+	c.chatProducer.Close()
+	c.chatConsumer.Close()
+	if c.inputProducer != nil {
+		c.inputProducer.Close()
+	}
+	if c.inputConsumer != nil {
+		c.inputConsumer.Close()
+	}
+	for _, guard := range c.nameGuards {
+		guard.Close()
+	}
 	c.client.Close()
 	c.closeCh <- struct{}{}
 	c.tableView.Close()
+	c.profileTable.Close()
 	close(c.closeCh)
 	close(c.consumeCh)
+	close(c.chatConsumeCh)
+	if c.inputConsumeCh != nil {
+		close(c.inputConsumeCh)
+	}
 }
 
-func newPulsarClient(roomName, playerName string) *pulsarClient {
+func newPulsarClient(roomName, playerName string, conn connectionConfig) *pulsarClient {
 	topicName := roomName + "-event-topic"
 	subscriptionName := playerName
-	client, err := pulsar.NewClient(pulsar.ClientOptions{
-		URL: pulsarUrl,
-	})
+	client, err := conn.newClient()
 	if err != nil {
 		log.Fatal("[newPulsarClient]", err)
 	}
 
+	c := &pulsarClient{
+		playerName:   playerName,
+		roomName:     roomName,
+		client:       client,
+		closeCh:      make(chan struct{}),
+		privateKeys:  map[string]ed25519.PrivateKey{},
+		signer:       playerName,
+		publicKeys:   map[string]ed25519.PublicKey{},
+		unknownKeys:  map[string]time.Time{},
+		keyNamespace: conn.KeyNamespace,
+	}
+	producerName := ""
+	if playerName == serverName {
+		// producer names are unique in a topic, nobody else can send as the server
+		producerName = c.getServerProducerName()
+		// the server signs as the server of its room
+		c.signer = producerName
+	}
 	// player event topicName
 	producer, err := client.CreateProducer(pulsar.ProducerOptions{
 		Topic:           topicName,
+		Name:            producerName,
 		DisableBatching: true,
 		// use schema to confirm the structure of message
 		Schema: pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
@@ -155,28 +274,110 @@ func newPulsarClient(roomName, playerName string) *pulsarClient {
 		log.Fatal(err)
 	}
 
-	tableView, err := client.CreateTableView(pulsar.TableViewOptions{
-		Topic:           roomName + "-score-topic",
-		Schema:          pulsar.NewStringSchema(nil),
-		SchemaValueType: reflect.TypeOf(""),
+	c.readScores()
+	c.readProfiles()
+	c.producer = producer
+	c.consumer = consumer
+	c.consumeCh = consumeCh
+	if err = c.publishKey(c.signer); err != nil {
+		log.Fatal("[newPulsarClient]", err)
+	}
+	c.subscribeChat()
+	return c
+}
+
+// guardName subscribe to the event topic as playerName, like the first local player,
+// the subscription is exclusive so nobody else logs in with the name. Its events are dropped.
+func (c *pulsarClient) guardName(playerName string) error {
+	consumer, err := c.client.Subscribe(pulsar.ConsumerOptions{
+		Topic:            c.getEventTopicName(),
+		SubscriptionName: playerName,
+		Type:             pulsar.Exclusive,
+		Schema:           pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
 	})
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if err = consumer.Seek(pulsar.LatestMessageID()); err != nil {
+		consumer.Close()
+		return err
 	}
+	c.nameGuards = append(c.nameGuards, consumer)
+	go func() {
+		for {
+			msg, err := consumer.Receive(context.Background())
+			if err != nil {
+				// closed
+				return
+			}
+			consumer.Ack(msg)
+		}
+	}()
+	return nil
+}
 
-	return &pulsarClient{
-		tableView:  tableView,
-		playerName: playerName,
-		roomName:   roomName,
-		client:     client,
-		producer:   producer,
-		consumer:   consumer,
-		consumeCh:  consumeCh,
-		closeCh:    make(chan struct{}),
+// subscribeChat create the producer and consumer of the chat topic, only new messages are received
+func (c *pulsarClient) subscribeChat() {
+	var err error
+	c.chatProducer, err = c.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:           c.getChatTopicName(),
+		DisableBatching: true,
+		Schema:          pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
+	})
+	if err != nil {
+		log.Fatal("[subscribeChat]", err)
+	}
+	c.chatConsumeCh = make(chan pulsar.ConsumerMessage)
+	c.chatConsumer, err = c.client.Subscribe(pulsar.ConsumerOptions{
+		Topic:                       c.getChatTopicName(),
+		SubscriptionName:            c.getChatSubscriptionName(),
+		Type:                        pulsar.Exclusive,
+		MessageChannel:              c.chatConsumeCh,
+		SubscriptionInitialPosition: pulsar.SubscriptionPositionLatest,
+		Schema:                      pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
+	})
+	if err != nil {
+		log.Fatal("[subscribeChat]", err)
+	}
+	if err = c.chatConsumer.Seek(pulsar.LatestMessageID()); err != nil {
+		log.Fatal("[subscribeChat]", err)
+	}
+}
+
+// produceInputs create the producer of the input topic, for remote clients
+func (c *pulsarClient) produceInputs() {
+	var err error
+	c.inputProducer, err = c.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:           c.getInputTopicName(),
+		DisableBatching: true,
+		Schema:          pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
+	})
+	if err != nil {
+		log.Fatal("[produceInputs]", err)
+	}
+}
+
+// subscribeInputs consume the input topic, for the server, only new inputs are received
+func (c *pulsarClient) subscribeInputs() {
+	var err error
+	c.inputConsumeCh = make(chan pulsar.ConsumerMessage)
+	c.inputConsumer, err = c.client.Subscribe(pulsar.ConsumerOptions{
+		Topic:                       c.getInputTopicName(),
+		SubscriptionName:            c.getInputSubscriptionName(),
+		Type:                        pulsar.Exclusive,
+		MessageChannel:              c.inputConsumeCh,
+		SubscriptionInitialPosition: pulsar.SubscriptionPositionLatest,
+		Schema:                      pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
+	})
+	if err != nil {
+		log.Fatal("this room already has a server")
+	}
+	if err = c.inputConsumer.Seek(pulsar.LatestMessageID()); err != nil {
+		log.Fatal("[subscribeInputs]", err)
 	}
 }
 
-// try grab exclusive consumer, if success, send new random graph
+// try grab exclusive consumer, if success, send new generated graph
 func (c *pulsarClient) tryUpdateObstacles() {
 	obstacleTopicName := c.getMapTopicName()
 	// every minute update random obstacle
@@ -213,22 +414,55 @@ func (c *pulsarClient) tryUpdateObstacles() {
 	}
 	defer producer.Close()
 
-	indestructibleObstacles := sample(totalGridCount, indestructibleObstacleCount)
-
-	var destructibleObstacles []int
-	for _, v := range sample(totalGridCount, indestructibleObstacleCount+destructibleObstacleCount) {
-		// ignore efficiency, just keep simple, brutal force deduplicate
-		if !sliceContains(indestructibleObstacles, v) {
-			// for destructibleObstacleType, we use negative number to present
-			destructibleObstacles = append(destructibleObstacles, -v)
+	gameMap := c.gameMap
+	if gameMap == nil {
+		seed := c.seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
 		}
+		gameMap, err = generateMap(c.generator, seed, c.size.width, c.size.height)
+		if err != nil {
+			log.Error("[tryUpdateObstacles]", err)
+			return
+		}
+	}
+
+	rules := c.rules
+	msg := convertEventToMsg(&UpdateMapEvent{
+		Obstacles: gameMap.obstacleCodes(),
+		gameMap:   gameMap,
+		rules:     &rules,
+	})
+	_, err = producer.Send(context.Background(), &pulsar.ProducerMessage{Value: msg})
+	if err != nil {
+		log.Error("[tryUpdateObstacles]", err)
+	}
+}
+
+// publishMap send gameMap to the map topic of roomName, it becomes the room's map
+func publishMap(roomName string, gameMap *GameMap, conn connectionConfig) error {
+	client, err := conn.newClient()
+	if err != nil {
+		return err
 	}
+	defer client.Close()
 
-	InitObstacleMsg := &EventMessage{
-		Type: InitObstacleEventType,
-		List: append(indestructibleObstacles, destructibleObstacles...),
+	producer, err := client.CreateProducer(pulsar.ProducerOptions{
+		Topic:           roomName + "-map-topic",
+		Schema:          pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
+		DisableBatching: true,
+	})
+	if err != nil {
+		return err
 	}
-	_, err = producer.Send(context.Background(), &pulsar.ProducerMessage{Value: InitObstacleMsg})
+	defer producer.Close()
+
+	msg := convertEventToMsg(&UpdateMapEvent{
+		Obstacles: gameMap.obstacleCodes(),
+		gameMap:   gameMap,
+	})
+	_, err = producer.Send(context.Background(), &pulsar.ProducerMessage{Value: msg})
+	return err
 }
 
 func (c *pulsarClient) readLatestEvent(topicName string) Event {
@@ -256,11 +490,22 @@ func (c *pulsarClient) readLatestEvent(topicName string) Event {
 	return nil
 }
 
+// trusted return why the event of a message can't be trusted, nil if it can.
+// In a room with a server, only the events of the server are trusted.
+func (c *pulsarClient) trusted(msg pulsar.Message, actionMsg *EventMessage, seen sequences) error {
+	if (c.server || c.remote) && msg.ProducerName() != c.getServerProducerName() {
+		return fmt.Errorf("not sent by the server of the room but %s", msg.ProducerName())
+	}
+	return c.verify(actionMsg, msg.Properties(), seen)
+}
+
 // start to receive message from pulsar, forwarding to receiveCh
 func (c *pulsarClient) start(in chan Event) chan Event {
 	// All players' action can be received from this channel
 	outCh := make(chan Event)
 	go func() {
+		// the sequence numbers of the senders of every topic received
+		events, chats, inputs := sequences{}, sequences{}, sequences{}
 		for {
 			select {
 			// receive message from pulsar, forwarding to outCh
@@ -279,23 +524,71 @@ func (c *pulsarClient) start(in chan Event) chan Event {
 				l := math.Min(float64(len(msg.Payload())), 100)
 				log.Info("receive message from pulsar:\n", string(msg.Payload())[:int(l)])
 				cm.Ack(msg)
+				if err = c.trusted(msg, &actionMsg, events); err != nil {
+					log.Warning("[start] drop an event: ", err)
+					break
+				}
+				switch actionMsg.Type {
+				case UserJoinEventType, UserMoveEventType, UserDeadEventType, UserReviveEventType:
+					c.receivePing(msg, actionMsg.Name)
+				}
+				event := convertMsgToEvent(&actionMsg)
+				if event == nil {
+					log.Warning("receive an unknown event ", actionMsg.Type)
+					break
+				}
+				if !c.server && !c.remote {
+					// without a server, every client checks the events of the others
+					event = &receivedEvent{
+						Event:  event,
+						sender: msg.Properties()[senderProperty],
+					}
+				}
+				outCh <- event
+
+			case cm := <-c.chatConsumeCh:
+				msg := cm.Message
+				if msg == nil {
+					log.Warning("receive a nil chat message")
+					break
+				}
+				cm.Ack(msg)
+				actionMsg := EventMessage{}
+				if err := msg.GetSchemaValue(&actionMsg); err != nil {
+					log.Error("[start][chat]", err)
+					break
+				}
+				if err := c.verify(&actionMsg, msg.Properties(), chats); err != nil {
+					log.Warning("[start][chat] drop an unverified message: ", err)
+					break
+				}
+				if actionMsg.Type != ChatEventType {
+					break
+				}
 				outCh <- convertMsgToEvent(&actionMsg)
 
-			// need to send message to pulsar
-			case action := <-in:
-				if action == nil {
-					log.Warning("send a nil message")
+			case cm := <-c.inputConsumeCh:
+				msg := cm.Message
+				if msg == nil {
+					log.Warning("receive a nil input message")
 					break
 				}
-				actionMsg := convertEventToMsg(action)
-				_, err := c.producer.Send(context.Background(), &pulsar.ProducerMessage{
-					Value: actionMsg,
-				})
-				if err != nil {
-					log.Error("send msg failed:", err)
+				cm.Ack(msg)
+				actionMsg := EventMessage{}
+				if err := msg.GetSchemaValue(&actionMsg); err != nil {
+					log.Error("[start][input]", err)
 					break
 				}
-				//log.Info("send message to pulsar:\n", string(bytes))
+				if err := c.verify(&actionMsg, msg.Properties(), inputs); err != nil {
+					log.Warning("[start][input] drop an unverified input: ", err)
+					break
+				}
+				if actionMsg.Type != InputEventType {
+					break
+				}
+				event := convertMsgToEvent(&actionMsg).(*InputEvent)
+				event.sender = msg.Properties()[senderProperty]
+				outCh <- event
 
 			case <-c.closeCh:
 				goto stop
@@ -304,10 +597,42 @@ func (c *pulsarClient) start(in chan Event) chan Event {
 		}
 	}()
 
+	// send to pulsar apart from receiving, so a game waiting for room
+	// in its queue never holds the events it has to receive
+	go func() {
+		for action := range in {
+			if action == nil {
+				log.Warning("send a nil message")
+				continue
+			}
+			producer := c.producer
+			switch action.(type) {
+			case *ChatEvent:
+				producer = c.chatProducer
+			case *InputEvent:
+				producer = c.inputProducer
+			}
+			actionMsg := convertEventToMsg(action)
+			properties := c.sign(actionMsg)
+			c.addPing(properties)
+			_, err := producer.Send(context.Background(), &pulsar.ProducerMessage{
+				Value:      actionMsg,
+				Properties: properties,
+			})
+			if err != nil {
+				log.Error("send msg failed:", err)
+				continue
+			}
+			//log.Info("send message to pulsar:\n", string(bytes))
+		}
+	}()
+
 	// handle obstacle topic
 	go func() {
-		// 1. try to init random map
-		c.tryUpdateObstacles()
+		// 1. try to init random map, the server of the room does it for remote clients
+		if !c.remote {
+			c.tryUpdateObstacles()
+		}
 
 		// 2. read the latest random map
 		obstacleTopicName := c.getMapTopicName()
@@ -339,7 +664,9 @@ func (c *pulsarClient) start(in chan Event) chan Event {
 			select {
 			case <-time.Tick(time.Second * updateObstacleTime):
 				// every minute update random obstacle
-				c.tryUpdateObstacles()
+				if !c.remote {
+					c.tryUpdateObstacles()
+				}
 			case cm := <-obstacleConsumerCh:
 				msg := cm.Message
 				if msg == nil {
@@ -354,7 +681,13 @@ func (c *pulsarClient) start(in chan Event) chan Event {
 					log.Error("[start][read map event]", err)
 					break
 				}
-				outCh <- convertMsgToEvent(&actionMsg)
+				event := convertMsgToEvent(&actionMsg)
+				if e, ok := event.(*UpdateMapEvent); ok && e.gameMap != nil && e.gameMap.Generator == "" {
+					// a map published by the editor becomes the room's map,
+					// keep it when updating obstacles
+					c.gameMap = e.gameMap
+				}
+				outCh <- event
 			}
 		}
 
@@ -363,6 +696,12 @@ func (c *pulsarClient) start(in chan Event) chan Event {
 	return outCh
 }
 
+// mapMessage is the comment of a map message, maps from the editor and old clients have no rules
+type mapMessage struct {
+	*GameMap
+	Rules *roomRules `json:"rules,omitempty"`
+}
+
 func convertEventToMsg(action Event) *EventMessage {
 	var msg *EventMessage
 	switch t := action.(type) {
@@ -393,6 +732,7 @@ func convertEventToMsg(action Event) *EventMessage {
 			Y:      t.pos.Y,
 			// record the killer player name
 			Comment: t.killer,
+			Pusher:  t.pusher,
 			Alive:   false,
 		}
 	case *UserReviveEvent:
@@ -413,10 +753,11 @@ func convertEventToMsg(action Event) *EventMessage {
 		}
 	case *BombMoveEvent:
 		msg = &EventMessage{
-			Type: MoveBombEventType,
-			Name: t.bombName,
-			X:    t.pos.X,
-			Y:    t.pos.Y,
+			Type:   MoveBombEventType,
+			Name:   t.bombName,
+			X:      t.pos.X,
+			Y:      t.pos.Y,
+			Pusher: t.pusher,
 		}
 	case *ExplodeEvent:
 		msg = &EventMessage{
@@ -428,14 +769,53 @@ func convertEventToMsg(action Event) *EventMessage {
 	case *UndoExplodeEvent:
 		msg = &EventMessage{
 			Type: UndoExplodeEventType,
+			Name: t.bombName,
 			X:    t.pos.X,
 			Y:    t.pos.Y,
 		}
+	case *ChatEvent:
+		msg = &EventMessage{
+			Type: ChatEventType,
+			Name: t.sender,
+			// the text of the message
+			Comment: t.text,
+		}
+	case *InputEvent:
+		msg = &EventMessage{
+			Type:   InputEventType,
+			Name:   t.name,
+			Avatar: t.avatar,
+			// the direction just pressed
+			X: int(t.in.pressed),
+		}
+		for dir, held := range t.in.held {
+			if held {
+				msg.List = append(msg.List, int(dir))
+			}
+		}
+		// one action at most, like act does
+		switch {
+		case t.in.bomb:
+			msg.Comment = "bomb"
+		case t.in.detonate:
+			msg.Comment = "detonate"
+		case t.in.revive:
+			msg.Comment = "revive"
+		}
 	case *UpdateMapEvent:
 		msg = &EventMessage{
 			Type: InitObstacleEventType,
 			List: t.Obstacles,
 		}
+		if t.gameMap != nil {
+			// the whole map is stored in comment, include spawns and item spawners, and the rules
+			bytes, err := json.Marshal(mapMessage{GameMap: t.gameMap, Rules: t.rules})
+			if err != nil {
+				log.Error("[convertEventToMsg]", err)
+				break
+			}
+			msg.Comment = string(bytes)
+		}
 	}
 	return msg
 }
@@ -451,6 +831,11 @@ func convertMsgToEvent(msg *EventMessage) Event {
 		alive: msg.Alive,
 	}
 	switch msg.Type {
+	case UserJoinEventType, UserMoveEventType, UserDeadEventType, UserReviveEventType, InputEventType:
+		// the avatar selects a skin, never trust it
+		info.avatar = validAvatar(msg.Avatar)
+	}
+	switch msg.Type {
 	case UserJoinEventType:
 		return &UserJoinEvent{
 			playerInfo: info,
@@ -464,6 +849,7 @@ func convertMsgToEvent(msg *EventMessage) Event {
 		return &BombMoveEvent{
 			bombName: msg.Name,
 			pos:      info.pos,
+			pusher:   msg.Pusher,
 		}
 	case UserMoveEventType:
 		return &UserMoveEvent{
@@ -473,6 +859,7 @@ func convertMsgToEvent(msg *EventMessage) Event {
 		return &UserDeadEvent{
 			playerInfo: info,
 			killer:     msg.Comment,
+			pusher:     msg.Pusher,
 		}
 	case UserReviveEventType:
 		return &UserReviveEvent{
@@ -485,12 +872,54 @@ func convertMsgToEvent(msg *EventMessage) Event {
 		}
 	case UndoExplodeEventType:
 		return &UndoExplodeEvent{
-			pos: info.pos,
+			bombName: msg.Name,
+			pos:      info.pos,
+		}
+	case ChatEventType:
+		return &ChatEvent{
+			sender: msg.Name,
+			text:   msg.Comment,
+		}
+	case InputEventType:
+		in := intent{
+			held:     map[Direction]bool{},
+			pressed:  validDirection(msg.X),
+			bomb:     msg.Comment == "bomb",
+			detonate: msg.Comment == "detonate",
+			revive:   msg.Comment == "revive",
+		}
+		for _, dir := range msg.List {
+			if d := validDirection(dir); d != dirNone {
+				in.held[d] = true
+			}
+		}
+		return &InputEvent{
+			name:   msg.Name,
+			avatar: info.avatar,
+			in:     in,
 		}
 	case InitObstacleEventType:
-		return &UpdateMapEvent{
+		event := &UpdateMapEvent{
 			Obstacles: msg.List,
 		}
+		if msg.Comment != "" {
+			m := mapMessage{GameMap: &GameMap{}}
+			if err := json.Unmarshal([]byte(msg.Comment), &m); err != nil {
+				log.Error("[convertMsgToEvent] invalid map", err)
+			} else if err = m.GameMap.validate(); err != nil {
+				log.Error("[convertMsgToEvent] invalid map", err)
+			} else {
+				event.gameMap = m.GameMap
+				if m.Rules != nil {
+					if err = m.Rules.validate(); err != nil {
+						log.Error("[convertMsgToEvent] invalid rules", err)
+					} else {
+						event.rules = m.Rules
+					}
+				}
+			}
+		}
+		return event
 	}
 	return nil
 }
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// size of the characters printed by ebitenutil.DebugPrint
+const (
+	debugCharWidth  = 6
+	debugCharHeight = 16
+)
+
+// layer of a sprite of the map, the sprites of a lower layer are drawn first
+type layer int
+
+const (
+	crumblingLayer layer = iota
+	itemLayer
+	bombLayer
+	playerLayer
+	flameLayer
+)
+
+// mapSprite is a frame drawn at grid x, y of the map, tinted if tint is not nil
+type mapSprite struct {
+	layer layer
+	x, y  float64
+	frame *ebiten.Image
+	tint  color.Color
+}
+
+// renderer draws the game layer by layer, from bottom to top:
+// obstacles, items, bombs, players, flames and the HUD.
+// Obstacles rarely change, so they are rendered offscreen once
+// and redrawn only when the obstacleMap changes.
+type renderer struct {
+	obstacleLayer *ebiten.Image
+	// obstacleVersion of the game when obstacleLayer was rendered
+	obstacleVersion int
+
+	sprites *sprites
+	// animation state of every player
+	players map[string]*playerSprite
+	// position of every bomb by name
+	bombs map[string]*tween
+	// the sprites of the frame above the obstacles, sorted by layer
+	mapSprites []mapSprite
+	// text is printed here first to be drawn translucent
+	textLayer *ebiten.Image
+	// the profiles of the leaderboard, loaded again when profileVersion changes
+	leaderboard        []*profile
+	leaderboardVersion int64
+}
+
+// playerSprite remembers what a player did to pick its animation
+type playerSprite struct {
+	pos     Position
+	tween   *tween
+	facing  Direction
+	movedAt time.Time
+	alive   bool
+	diedAt  time.Time
+}
+
+func (r *renderer) draw(g *Game, screen *ebiten.Image) {
+	if r.sprites == nil {
+		r.sprites = loadSprites()
+		r.players = map[string]*playerSprite{}
+		r.bombs = map[string]*tween{}
+	}
+
+	// every local player has a viewport above the score bar, they show the same sprites
+	r.collectSprites(g)
+	for _, lp := range g.localPlayers {
+		cam := &lp.camera
+		view := screen.SubImage(cam.viewport).(*ebiten.Image)
+		r.drawObstacles(g, cam, view)
+		for _, s := range r.mapSprites {
+			r.drawSpriteAt(cam, view, s.x, s.y, s.frame, s.tint)
+		}
+		r.drawNameTags(g, cam, view)
+		r.drawHUD(g, lp, view)
+	}
+	if g.showScoreboard {
+		r.drawScoreboard(g, screen)
+	} else if g.showLeaderboard {
+		r.drawLeaderboard(g, screen)
+	}
+	r.drawChat(g, screen)
+	r.drawKillFeed(g, screen)
+	r.drawScores(g, screen)
+}
+
+func (r *renderer) drawObstacles(g *Game, cam *camera, view *ebiten.Image) {
+	g.obstacleLock.RLock()
+	defer g.obstacleLock.RUnlock()
+
+	w, h := g.size.width*gridSize, g.size.height*gridSize
+	if r.obstacleLayer == nil || r.obstacleLayer.Bounds().Dx() != w || r.obstacleLayer.Bounds().Dy() != h {
+		if r.obstacleLayer != nil {
+			r.obstacleLayer.Dispose()
+		}
+		r.obstacleLayer = ebiten.NewImage(w, h)
+		// force to render
+		r.obstacleVersion = g.obstacleVersion - 1
+	}
+	if r.obstacleVersion != g.obstacleVersion {
+		r.obstacleLayer.Clear()
+		for pos, t := range g.obstacleMap {
+			col := blockColWall
+			if t == destructibleObstacleType {
+				col = blockColBlock
+			}
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Translate(float64(pos.X*gridSize), float64(pos.Y*gridSize))
+			r.obstacleLayer.DrawImage(r.sprites.block.frame(col, 0), op)
+		}
+		r.obstacleVersion = g.obstacleVersion
+	}
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(cam.screenXY(Position{}))
+	view.DrawImage(r.obstacleLayer, op)
+}
+
+// collectSprites find the sprites of the frame above the obstacles, in the order of their layers.
+// Every layer adds its sprites in a fixed order, so overlapping sprites don't flicker.
+func (r *renderer) collectSprites(g *Game) {
+	r.mapSprites = r.mapSprites[:0]
+	r.addCrumbling(g)
+	r.addItems(g)
+	r.addBombs(g)
+	r.addPlayers(g)
+	r.addFlames(g)
+	sort.SliceStable(r.mapSprites, func(i, j int) bool {
+		return r.mapSprites[i].layer < r.mapSprites[j].layer
+	})
+}
+
+// add a sprite to the frame at grid x, y
+func (r *renderer) add(l layer, x, y float64, frame *ebiten.Image, tint color.Color) {
+	r.mapSprites = append(r.mapSprites, mapSprite{layer: l, x: x, y: y, frame: frame, tint: tint})
+}
+
+func (r *renderer) addCrumbling(g *Game) {
+	g.obstacleLock.RLock()
+	defer g.obstacleLock.RUnlock()
+	positions := make([]Position, 0, len(g.crumbling))
+	for pos := range g.crumbling {
+		positions = append(positions, pos)
+	}
+	sortPositions(positions)
+	now := time.Now()
+	for _, pos := range positions {
+		if elapsed := now.Sub(g.crumbling[pos]); elapsed < crumbleDuration {
+			r.add(crumblingLayer, float64(pos.X), float64(pos.Y), r.sprites.crumbling(elapsed), nil)
+		}
+	}
+}
+
+func (r *renderer) addItems(g *Game) {
+	if g.gameMap == nil {
+		return
+	}
+	for _, pos := range g.gameMap.ItemSpawners {
+		r.add(itemLayer, float64(pos.X)+0.25, float64(pos.Y)+0.25, r.sprites.item, nil)
+	}
+}
+
+func (r *renderer) addBombs(g *Game) {
+	positions := make([]Position, 0, len(g.posToBombs))
+	for pos := range g.posToBombs {
+		positions = append(positions, pos)
+	}
+	sortPositions(positions)
+	now := time.Now()
+	for _, pos := range positions {
+		bomb := g.posToBombs[pos]
+		t, ok := r.bombs[bomb.bombName]
+		if !ok {
+			t = newTween(pos)
+			r.bombs[bomb.bombName] = t
+		} else if t.to != pos {
+			// pushed
+			t.moveTo(pos, now, bombMoveDuration)
+		}
+		x, y := t.at(now)
+		r.add(bombLayer, x, y, r.sprites.bombFuse().frame(now.Sub(bomb.setTime)), nil)
+	}
+	for name := range r.bombs {
+		if _, ok := g.nameToBombs[name]; !ok {
+			// exploded
+			delete(r.bombs, name)
+		}
+	}
+}
+
+// sortedPlayers are the players in the order they are drawn, dead players below alive players, then by name
+func sortedPlayers(g *Game) []*playerInfo {
+	players := make([]*playerInfo, 0, len(g.nameToPlayers))
+	for _, player := range g.nameToPlayers {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].alive != players[j].alive {
+			return !players[i].alive
+		}
+		return players[i].name < players[j].name
+	})
+	return players
+}
+
+func (r *renderer) addPlayers(g *Game) {
+	now := time.Now()
+	for _, player := range sortedPlayers(g) {
+		sprite := r.updatePlayerSprite(g, player, now)
+		var frame *ebiten.Image
+		if !player.alive {
+			frame = r.sprites.death().frame(now.Sub(sprite.diedAt))
+		} else if walking := now.Sub(sprite.movedAt); walking < walkDuration {
+			frame = r.sprites.walk(sprite.facing).frame(walking)
+		} else {
+			// stand still
+			frame = r.sprites.walk(sprite.facing).frame(0)
+		}
+		x, y := sprite.tween.at(now)
+		if g.localPlayer(player.name) != nil {
+			r.add(playerLayer, x-1.0/gridSize, y-1.0/gridSize, r.sprites.highlight, nil)
+		}
+		skin, ok := skins[player.avatar]
+		if !ok {
+			skin = skins[defaultAvatar]
+		}
+		r.add(playerLayer, x, y, frame, skin)
+	}
+}
+
+// drawNameTags print the names above every sprite
+func (r *renderer) drawNameTags(g *Game, cam *camera, view *ebiten.Image) {
+	now := time.Now()
+	for _, player := range sortedPlayers(g) {
+		if sprite, ok := r.players[player.name]; ok {
+			x, y := sprite.tween.at(now)
+			r.drawNameTag(cam, view, player.name, x, y)
+		}
+	}
+}
+
+// drawNameTag print the name centered above the player at grid x, y
+func (r *renderer) drawNameTag(cam *camera, view *ebiten.Image, name string, x, y float64) {
+	x, y = cam.screenXYf(x, y)
+	x += gridSize/2 - float64(len(name)*debugCharWidth)/2
+	y -= debugCharHeight
+	ebitenutil.DebugPrintAt(view, name, int(x), int(y))
+}
+
+// updatePlayerSprite compare player with the last frame to find how it moves and when it dies
+func (r *renderer) updatePlayerSprite(g *Game, player *playerInfo, now time.Time) *playerSprite {
+	sprite, ok := r.players[player.name]
+	if !ok {
+		sprite = &playerSprite{pos: player.pos, tween: newTween(player.pos), facing: dirDown, alive: true}
+		r.players[player.name] = sprite
+	}
+	if player.pos != sprite.pos {
+		switch {
+		case player.pos.X < sprite.pos.X:
+			sprite.facing = dirLeft
+		case player.pos.X > sprite.pos.X:
+			sprite.facing = dirRight
+		case player.pos.Y < sprite.pos.Y:
+			sprite.facing = dirUp
+		default:
+			sprite.facing = dirDown
+		}
+		duration := remoteMoveDuration
+		if g.localPlayer(player.name) != nil {
+			duration = localMoveDuration
+		}
+		sprite.tween.moveTo(player.pos, now, duration)
+		sprite.pos = player.pos
+		sprite.movedAt = now
+	}
+	if sprite.alive && !player.alive {
+		sprite.diedAt = now
+	}
+	sprite.alive = player.alive
+	return sprite
+}
+
+func (r *renderer) addFlames(g *Game) {
+	g.flameLock.RLock()
+	defer g.flameLock.RUnlock()
+	positions := make([]Position, 0, len(g.flameMap))
+	for pos, val := range g.flameMap {
+		// only val > 0 means flame
+		if val != nil {
+			positions = append(positions, pos)
+		}
+	}
+
+	sortPositions(positions)
+	// all flames flicker together
+	elapsed := time.Duration(time.Now().UnixNano())
+	for _, pos := range positions {
+		r.add(flameLayer, float64(pos.X), float64(pos.Y), r.sprites.flamePiece(flamePiece(g.flameMap, pos), elapsed), nil)
+	}
+}
+
+// flamePiece decide the column in flame.png by the neighbours of the same bomb
+func flamePiece(flameMap map[Position]*Bomb, pos Position) int {
+	bomb := flameMap[pos]
+	switch {
+	case pos == bomb.pos:
+		return flameColCenter
+	case pos.Y == bomb.pos.Y && pos.X < bomb.pos.X:
+		if flameMap[Position{X: pos.X - 1, Y: pos.Y}] != bomb {
+			return flameColTipLeft
+		}
+		return flameColHorizontal
+	case pos.Y == bomb.pos.Y:
+		if flameMap[Position{X: pos.X + 1, Y: pos.Y}] != bomb {
+			return flameColTipRight
+		}
+		return flameColHorizontal
+	case pos.Y < bomb.pos.Y:
+		if flameMap[Position{X: pos.X, Y: pos.Y - 1}] != bomb {
+			return flameColTipUp
+		}
+		return flameColVertical
+	default:
+		if flameMap[Position{X: pos.X, Y: pos.Y + 1}] != bomb {
+			return flameColTipDown
+		}
+		return flameColVertical
+	}
+}
+
+// drawHUD print the messages of a local player at the top left of its viewport
+func (r *renderer) drawHUD(g *Game, lp *localPlayer, view *ebiten.Image) {
+	x, y := lp.camera.viewport.Min.X, lp.camera.viewport.Min.Y
+	if len(g.localPlayers) > 1 {
+		ebitenutil.DebugPrintAt(view, lp.name, x, y)
+		y += debugCharHeight
+	}
+	if lp.rebinder.active {
+		ebitenutil.DebugPrintAt(view, lp.rebinder.prompt(), x, y)
+	} else if !g.nameToPlayers[lp.name].alive {
+		ebitenutil.DebugPrintAt(view, "You are dead, press "+lp.controls.keyName(actionRevive)+" to revive.", x, y)
+		if lp.recap != nil {
+			ebitenutil.DebugPrintAt(view, lp.recap.String(), x, y+debugCharHeight)
+		}
+	}
+}
+
+func (r *renderer) drawScores(g *Game, screen *ebiten.Image) {
+	scoreStr := strings.Builder{}
+	scoreStr.WriteString("scores: ")
+	for _, name := range g.rankedPlayers() {
+		scoreStr.WriteString(name)
+		scoreStr.WriteString(" = ")
+		scoreStr.WriteString(strconv.Itoa(g.score(name)) + "; ")
+	}
+	// print the score of all players
+	ebitenutil.DebugPrintAt(screen, scoreStr.String(), 0, screenHeight-scoreBarHeight+10)
+}
+
+// drawSprite draw a frame on a grid of the map relative to the camera, tint it if c is not nil
+func (r *renderer) drawSprite(cam *camera, view *ebiten.Image, pos Position, frame *ebiten.Image, c color.Color) {
+	r.drawSpriteAt(cam, view, float64(pos.X), float64(pos.Y), frame, c)
+}
+
+// drawSpriteAt is drawSprite at grid x, y which may be between grids
+func (r *renderer) drawSpriteAt(cam *camera, view *ebiten.Image, x, y float64, frame *ebiten.Image, c color.Color) {
+	x, y = cam.screenXYf(x, y)
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(x, y)
+	if c != nil {
+		op.ColorM.ScaleWithColor(c)
+	}
+	view.DrawImage(frame, op)
+}
+
+// sortPositions sort by row, then column
+func sortPositions(positions []Position) {
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Y != positions[j].Y {
+			return positions[i].Y < positions[j].Y
+		}
+		return positions[i].X < positions[j].X
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// testRenderGame is a full map of walls and blocks with a local player, other players, bombs and flames
+func testRenderGame() *Game {
+	g := newGameState(defaultConfig(), newSimClock(), 1)
+	g.gameMap = &GameMap{Width: g.size.width, Height: g.size.height}
+	g.obstacleMap = map[Position]ObstacleType{}
+	for x := 0; x < g.size.width; x++ {
+		for y := 0; y < g.size.height; y++ {
+			pos := Position{X: x, Y: y}
+			switch {
+			case x%2 == 1 && y%2 == 1:
+				g.obstacleMap[pos] = indestructibleObstacleType
+			case (x+y)%3 == 0:
+				g.obstacleMap[pos] = destructibleObstacleType
+			case (x+y)%3 == 1:
+				g.gameMap.ItemSpawners = append(g.gameMap.ItemSpawners, pos)
+			}
+		}
+	}
+	for i := 0; i < 8; i++ {
+		pos := Position{X: 2 * i, Y: 0}
+		name := fmt.Sprintf("p%d", i)
+		player := &playerInfo{name: name, avatar: defaultAvatar, pos: pos, alive: i%4 != 0}
+		g.nameToPlayers[name] = player
+		g.posToPlayers[pos] = player
+		bomb := &Bomb{playerName: name, bombName: name + "-1", pos: pos, setTime: time.Now()}
+		g.nameToBombs[bomb.bombName] = bomb
+		g.posToBombs[pos] = bomb
+		g.flameMap[pos] = bomb
+		g.flameMap[Position{X: pos.X + 1, Y: 0}] = bomb
+	}
+	g.localPlayers = []*localPlayer{{name: "p1", camera: newCamera(viewports(1)[0])}}
+	g.renderer = renderer{sprites: loadSprites(), players: map[string]*playerSprite{}, bombs: map[string]*tween{}}
+	return g
+}
+
+func TestRenderLayers(t *testing.T) {
+	g := testRenderGame()
+	g.crumbling[Position{X: 0, Y: 0}] = time.Now()
+	g.gameMap.ItemSpawners = append(g.gameMap.ItemSpawners, Position{X: 0, Y: 0})
+	// collected twice, the order must not depend on the maps of the game
+	for i := 0; i < 2; i++ {
+		g.renderer.collectSprites(g)
+		sprites := g.renderer.mapSprites
+		if len(sprites) == 0 {
+			t.Fatal("no sprite")
+		}
+		for j := 1; j < len(sprites); j++ {
+			if sprites[j].layer < sprites[j-1].layer {
+				t.Fatalf("sprite %d of layer %d is drawn after layer %d", j, sprites[j].layer, sprites[j-1].layer)
+			}
+		}
+		// everything overlaps at 0,0, from bottom to top
+		var at []layer
+		for _, s := range sprites {
+			if int(s.x) == 0 && int(s.y) == 0 && s.x >= 0 && s.y >= 0 {
+				at = append(at, s.layer)
+			}
+		}
+		want := []layer{crumblingLayer, itemLayer, bombLayer, playerLayer, flameLayer}
+		if fmt.Sprint(at) != fmt.Sprint(want) {
+			t.Errorf("layers at 0,0 %v, want %v", at, want)
+		}
+	}
+}
+
+// benchmarkDraw draw whole frames of a busy game,
+// changing the obstacleMap before every frame if changed
+func benchmarkDraw(b *testing.B, changed bool) {
+	g := testRenderGame()
+	screen := ebiten.NewImage(screenWidth, screenHeight)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if changed {
+			g.obstacleVersion++
+		}
+		g.Draw(screen)
+	}
+}
+
+func BenchmarkDrawCached(b *testing.B) {
+	benchmarkDraw(b, false)
+}
+
+func BenchmarkDrawObstaclesChanged(b *testing.B) {
+	benchmarkDraw(b, true)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"github.com/apache/pulsar-client-go/pulsar"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// scorerName names a standalone scorer
+	scorerName = "scorer"
+	// a client which is not the scorer of its room tries again after scorerRetryTime
+	scorerRetryTime = 10 * time.Second
+)
+
+// the subscription of the scorer to the event topic is exclusive, a room has one scorer,
+// and durable, a new scorer goes on from the last death scored
+func (c *pulsarClient) getScorerSubscriptionName() string {
+	return c.roomName + "-scorer-sub"
+}
+
+// readScores follow the scores of the room
+func (c *pulsarClient) readScores() {
+	var err error
+	c.tableView, err = c.client.CreateTableView(pulsar.TableViewOptions{
+		Topic:           c.getScoreTopicName(),
+		Schema:          pulsar.NewStringSchema(nil),
+		SchemaValueType: reflect.TypeOf(""),
+	})
+	if err != nil {
+		log.Fatal("[readScores]", err)
+	}
+}
+
+// newScorerClient connect a standalone scorer to a room, remote rooms have a server
+func newScorerClient(roomName string, conn connectionConfig, remote bool) *pulsarClient {
+	client, err := conn.newClient()
+	if err != nil {
+		log.Fatal("[newScorerClient]", err)
+	}
+	c := &pulsarClient{
+		roomName:   roomName,
+		playerName: scorerName,
+		client:     client,
+		remote:     remote,
+		// the standalone scorer signs its rounds as the scorer of its room
+		signer:       roomName + "-" + scorerName,
+		privateKeys:  map[string]ed25519.PrivateKey{},
+		publicKeys:   map[string]ed25519.PublicKey{},
+		unknownKeys:  map[string]time.Time{},
+		keyNamespace: conn.KeyNamespace,
+	}
+	if err = c.publishKey(c.signer); err != nil {
+		log.Fatal("[newScorerClient]", err)
+	}
+	c.readScores()
+	c.readProfiles()
+	return c
+}
+
+// runScorer try to become the scorer of the room until it is, then score the deaths with rules
+func (c *pulsarClient) runScorer(rules scoreRules) {
+	// every scorer may apply the rounds of every room to the profiles
+	go c.runProfileUpdater()
+	for {
+		consumeCh := make(chan pulsar.ConsumerMessage)
+		consumer, err := c.client.Subscribe(pulsar.ConsumerOptions{
+			Topic:                       c.getEventTopicName(),
+			SubscriptionName:            c.getScorerSubscriptionName(),
+			Type:                        pulsar.Exclusive,
+			MessageChannel:              consumeCh,
+			SubscriptionInitialPosition: pulsar.SubscriptionPositionLatest,
+			Schema:                      pulsar.NewJSONSchema(eventJsonSchemaDef, nil),
+		})
+		if err == nil {
+			// this client is the scorer until it fails
+			log.Info("[runScorer] scoring room ", c.roomName)
+			if err = c.score(consumeCh, rules); err != nil {
+				log.Error("[runScorer]", err)
+			}
+			consumer.Close()
+		}
+		time.Sleep(scorerRetryTime)
+	}
+}
+
+// score publish the score of the players of every trusted death received on consumeCh,
+// the scores go on from the score topic. When the map of the room changes, the round
+// is sent to the profile updater, a round in progress is lost if the scorer fails.
+func (c *pulsarClient) score(consumeCh chan pulsar.ConsumerMessage, rules scoreRules) error {
+	producer, err := c.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:  c.getScoreTopicName(),
+		Schema: pulsar.NewStringSchema(nil),
+		// the scores of a death are flushed in one batch, which is stored at once,
+		// so a death is scored for every player or for nobody
+		BatchingMaxPublishDelay: time.Hour,
+	})
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+	roundProducer, err := c.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:           roundTopicName,
+		DisableBatching: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer roundProducer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mapCh, err := c.watchMaps(ctx)
+	if err != nil {
+		return err
+	}
+	// the rules of the room win over the rules of the scorer
+	current, _ := c.readLatestEvent(c.getMapTopicName()).(*UpdateMapEvent)
+	if current != nil && current.rules != nil && current.rules.Scoring != nil {
+		rules = *current.rules.Scoring
+	}
+
+	scores := map[string]int{}
+	for name, v := range c.tableView.Entries() {
+		if score, err := strconv.Atoi(*v.(*string)); err == nil {
+			scores[name] = score
+		}
+	}
+
+	r := newRound(c.roomName)
+	seen := sequences{}
+	for {
+		var cm pulsar.ConsumerMessage
+		select {
+		case e := <-mapCh:
+			if e.rules != nil && e.rules.Scoring != nil {
+				rules = *e.rules.Scoring
+			}
+			if sameMap(current, e) {
+				// the map is published again from time to time, the round goes on
+				continue
+			}
+			if err = c.endRound(roundProducer, r); err != nil {
+				return err
+			}
+			r = newRound(c.roomName)
+			current = e
+			continue
+		case cm = <-consumeCh:
+		}
+		msg := cm.Message
+		if msg == nil {
+			continue
+		}
+		actionMsg := EventMessage{}
+		if err = msg.GetSchemaValue(&actionMsg); err != nil {
+			cm.Ack(msg)
+			continue
+		}
+		switch actionMsg.Type {
+		case UserJoinEventType, UserMoveEventType, UserReviveEventType, UserDeadEventType:
+		default:
+			cm.Ack(msg)
+			continue
+		}
+		// the victim signed its death, nobody scores with the deaths of others
+		if err = c.trusted(msg, &actionMsg, seen); err != nil {
+			log.Warning("[score] drop an event: ", err)
+			cm.Ack(msg)
+			continue
+		}
+		if actionMsg.Type != UserDeadEventType {
+			// the player plays the round
+			r.Players[actionMsg.Name] = true
+			cm.Ack(msg)
+			continue
+		}
+
+		records := deathScores(scores, rules, actionMsg.Name, actionMsg.Comment, actionMsg.Pusher)
+		var messages []*pulsar.ProducerMessage
+		for name, score := range records {
+			messages = append(messages, &pulsar.ProducerMessage{Key: name, Value: strconv.Itoa(score)})
+		}
+		if err = sendBatch(producer, messages); err != nil {
+			// not acked, the next scorer scores it again
+			return err
+		}
+		for name, score := range records {
+			scores[name] = score
+		}
+		r.death(rules, actionMsg.Name, actionMsg.Comment, actionMsg.Pusher)
+		cm.Ack(msg)
+	}
+}
+
+// deathScores return the new score of every player credited for the death of victim,
+// scores is not changed
+func deathScores(scores map[string]int, rules scoreRules, victim, placer, pusher string) map[string]int {
+	points := rules.credit(victim, placer, pusher)
+	// the victim gets a score even without points, to be on the scoreboard
+	points[victim] += 0
+	records := map[string]int{}
+	for name, p := range points {
+		records[name] = scores[name] + p
+	}
+	return records
+}
+
+// sendBatch send messages in one batch, the producer must not flush by itself
+func sendBatch(producer pulsar.Producer, messages []*pulsar.ProducerMessage) error {
+	var lock sync.Mutex
+	var sendErr error
+	for _, msg := range messages {
+		producer.SendAsync(context.Background(), msg, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			if err != nil {
+				lock.Lock()
+				sendErr = err
+				lock.Unlock()
+			}
+		})
+	}
+	if err := producer.Flush(); err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	return sendErr
+}
+
+// watchMaps send every map published to the room from now on, until ctx is done
+func (c *pulsarClient) watchMaps(ctx context.Context) (chan *UpdateMapEvent, error) {
+	reader, err := c.client.CreateReader(pulsar.ReaderOptions{
+		Topic:          c.getMapTopicName(),
+		StartMessageID: pulsar.LatestMessageID(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	mapCh := make(chan *UpdateMapEvent)
+	go func() {
+		defer reader.Close()
+		for {
+			msg, err := reader.Next(ctx)
+			if err != nil {
+				return
+			}
+			actionMsg := EventMessage{}
+			if err = json.Unmarshal(msg.Payload(), &actionMsg); err != nil {
+				continue
+			}
+			e, ok := convertMsgToEvent(&actionMsg).(*UpdateMapEvent)
+			if !ok {
+				continue
+			}
+			select {
+			case mapCh <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return mapCh, nil
+}
+
+// sameMap reports whether the maps of a and b have the same size and obstacles,
+// a map published again is the same map
+func sameMap(a, b *UpdateMapEvent) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return mapEventSize(a) == mapEventSize(b) && reflect.DeepEqual(a.Obstacles, b.Obstacles)
+}
+
+// mapEventSize is the size of the map of e, maps of old clients fill one screen
+func mapEventSize(e *UpdateMapEvent) mapSize {
+	if e.gameMap == nil {
+		return defaultMapSize
+	}
+	return e.gameMap.size()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCredit(t *testing.T) {
+	pusherRules := defaultScoreRules
+	pusherRules.PusherGetsKill = true
+	pusherRules.Assist = 1
+
+	tests := []struct {
+		name                   string
+		rules                  scoreRules
+		victim, placer, pusher string
+		want                   map[string]int
+	}{
+		{"kill", defaultScoreRules, "bob", "alice", "", map[string]int{"alice": 1}},
+		{"suicide", defaultScoreRules, "alice", "alice", "", map[string]int{"alice": -1}},
+		{"random bomb", defaultScoreRules, "alice", "random", "", map[string]int{}},
+		{"pushed bomb", defaultScoreRules, "carol", "alice", "bob", map[string]int{"alice": 1, "bob": 0}},
+		{"pusher gets the kill", pusherRules, "carol", "alice", "bob", map[string]int{"bob": 1, "alice": 1}},
+		{"pushed own bomb", pusherRules, "carol", "alice", "alice", map[string]int{"alice": 1}},
+		{"pushed into own bomb", pusherRules, "bob", "alice", "bob", map[string]int{"bob": -1, "alice": 1}},
+		{"pushed random bomb", pusherRules, "carol", "random", "bob", map[string]int{"bob": 1}},
+		{"random bomb pushed by the victim", pusherRules, "bob", "random", "bob", map[string]int{"bob": -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.credit(tt.victim, tt.placer, tt.pusher); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("credit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeathScores(t *testing.T) {
+	scores := map[string]int{}
+	deaths := []struct {
+		victim, placer, pusher string
+		want                   map[string]int
+	}{
+		{"bob", "alice", "", map[string]int{"alice": 1, "bob": 0}},
+		{"alice", "alice", "", map[string]int{"alice": 0}},
+		{"carol", "random", "", map[string]int{"carol": 0}},
+		{"bob", "alice", "carol", map[string]int{"alice": 1, "bob": 0, "carol": 0}},
+		{"alice", "bob", "", map[string]int{"bob": 1, "alice": 1}},
+	}
+	for i, d := range deaths {
+		records := deathScores(scores, defaultScoreRules, d.victim, d.placer, d.pusher)
+		if !reflect.DeepEqual(records, d.want) {
+			t.Fatalf("death %d: records = %v, want %v", i+1, records, d.want)
+		}
+		for name, score := range records {
+			scores[name] = score
+		}
+	}
+	want := map[string]int{"alice": 1, "bob": 1, "carol": 0}
+	if !reflect.DeepEqual(scores, want) {
+		t.Errorf("scores = %v, want %v", scores, want)
+	}
+}
+
+func TestDeathScoresKeepScores(t *testing.T) {
+	scores := map[string]int{"alice": 3}
+	deathScores(scores, defaultScoreRules, "bob", "alice", "")
+	if len(scores) != 1 || scores["alice"] != 3 {
+		t.Errorf("deathScores changed the scores: %v", scores)
+	}
+}
+
+func TestRoomScoring(t *testing.T) {
+	g := newGameState(defaultConfig(), newSimClock(), 1)
+	rules := scoreRules{Kill: 3, Assist: 1, Suicide: -2, PusherGetsKill: true}
+	(&UpdateMapEvent{rules: &roomRules{Speed: maxSpeed, Scoring: &rules}}).handle(g)
+	g.recordDeath("carol", "alice", "bob")
+	if g.stats("bob").points != 3 || g.stats("alice").points != 1 {
+		t.Errorf("points of bob %d, alice %d, want 3, 1 with the rules of the room",
+			g.stats("bob").points, g.stats("alice").points)
+	}
+
+	msg := convertEventToMsg(&UpdateMapEvent{
+		gameMap: &GameMap{Width: 10, Height: 10, Spawns: []Position{{X: 1, Y: 1}}},
+		rules:   &roomRules{Speed: maxSpeed, Scoring: &rules},
+	})
+	e, ok := convertMsgToEvent(msg).(*UpdateMapEvent)
+	if !ok || e.rules == nil || e.rules.Scoring == nil || *e.rules.Scoring != rules {
+		t.Errorf("the scoring is not sent with the map: %+v", e)
+	}
+
+	rules.Kill = 1000
+	if err := (&roomRules{Speed: maxSpeed, Scoring: &rules}).validate(); err == nil {
+		t.Error("1000 points for a kill are valid")
+	}
+}
+
+func TestSameMap(t *testing.T) {
+	gameMap := &GameMap{Width: 10, Height: 10, Walls: []Position{{X: 1, Y: 1}}, Blocks: []Position{{X: 2, Y: 2}}}
+	event := func(m *GameMap) *UpdateMapEvent {
+		return &UpdateMapEvent{Obstacles: m.obstacleCodes(), gameMap: m}
+	}
+	moved := &GameMap{Width: 10, Height: 10, Walls: []Position{{X: 1, Y: 2}}, Blocks: []Position{{X: 2, Y: 2}}}
+	larger := &GameMap{Width: 12, Height: 10, Walls: []Position{{X: 1, Y: 1}}, Blocks: []Position{{X: 2, Y: 2}}}
+
+	if !sameMap(event(gameMap), event(gameMap)) {
+		t.Error("a map published again is another map")
+	}
+	if sameMap(event(gameMap), event(moved)) || sameMap(event(gameMap), event(larger)) {
+		t.Error("a map with other obstacles or another size is the same map")
+	}
+	if sameMap(nil, event(gameMap)) {
+		t.Error("the first map is the same map as none")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+// scoreRules decide the points of a death, they are saved in the config file
+type scoreRules struct {
+	// points of the player credited with a kill
+	Kill int `json:"kill"`
+	// points of the other player who helped, the pusher or the placer of the bomb
+	Assist int `json:"assist"`
+	// points of a player who kills itself, usually negative
+	Suicide int `json:"suicide"`
+	// credit the kill to the last pusher of the bomb instead of its placer,
+	// then the placer gets the assist
+	PusherGetsKill bool `json:"pusherGetsKill"`
+}
+
+var defaultScoreRules = scoreRules{
+	Kill:    1,
+	Assist:  0,
+	Suicide: -1,
+}
+
+// killer decide who is credited with the death of victim and who assists,
+// placer set the bomb and pusher pushed it last, empty if nobody pushed it.
+// The killer is victim for suicides and empty when nobody is credited.
+func (r scoreRules) killer(victim, placer, pusher string) (killer, assist string) {
+	killer = placer
+	if killer == "random" {
+		// random bombs never score, their pusher may
+		killer = ""
+	}
+	if pusher == placer {
+		pusher = ""
+	}
+	if r.PusherGetsKill && pusher != "" {
+		killer, pusher = pusher, killer
+	}
+	if pusher == victim {
+		pusher = ""
+	}
+	return killer, pusher
+}
+
+// credit return the points every player gets for the death of victim
+func (r scoreRules) credit(victim, placer, pusher string) map[string]int {
+	points := map[string]int{}
+	killer, assist := r.killer(victim, placer, pusher)
+	switch killer {
+	case "":
+	case victim:
+		points[victim] += r.Suicide
+	default:
+		points[killer] += r.Kill
+	}
+	if assist != "" {
+		points[assist] += r.Assist
+	}
+	return points
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// serverName subscribes the authoritative server of a room, players can't take it
+const serverName = "server"
+
+// serverSendQueueSize is the capacity of the events the server queues to send,
+// when it is full the server waits for pulsar
+const serverSendQueueSize = 1024
+
+// InputEvent is what a player of a remote client wants to do,
+// it goes to the input topic and only the server of the room handles it
+type InputEvent struct {
+	name, avatar string
+	in           intent
+	// the player who signed the input, only set when received
+	sender string
+}
+
+func (e *InputEvent) handle(game *Game) {
+	if !game.server {
+		return
+	}
+	// a player is played by the inputs signed with its key, nobody else holds its name
+	if e.sender != e.name {
+		log.Warnf("[InputEvent] drop an input of %q sent by %q", e.name, e.sender)
+		return
+	}
+	a := game.agent(e.name)
+	if a == nil {
+		if err := validPlayerName(e.name); err != nil {
+			log.Warn("[InputEvent] drop an input: ", err)
+			return
+		}
+		a = game.addRemotePlayer(e.name, e.avatar)
+	}
+	if !game.nameToPlayers[e.name].alive {
+		// dead players can only revive
+		a.next = intent{revive: a.next.revive || e.in.revive}
+		return
+	}
+	// the directions are held until the next input, actions are only done once
+	a.next.held = e.in.held
+	if e.in.pressed != dirNone {
+		a.next.pressed = e.in.pressed
+	}
+	a.next.bomb = a.next.bomb || e.in.bomb
+	a.next.detonate = a.next.detonate || e.in.detonate
+	a.next.revive = a.next.revive || e.in.revive
+}
+
+// agent find a player played by this game by name, nil if there is none
+func (g *Game) agent(name string) *agent {
+	for _, a := range g.agents {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// addRemotePlayer let the server play a new player, it joins the room
+// and goes to a spawn point if the map is known
+func (g *Game) addRemotePlayer(name, avatar string) *agent {
+	a := &agent{name: name, mover: newMover(g.speed)}
+	g.agents = append(g.agents, a)
+	info := &playerInfo{
+		name:   name,
+		avatar: avatar,
+		alive:  true,
+	}
+	g.nameToPlayers[name] = info
+	g.sendAsync(&UserJoinEvent{
+		playerInfo: info,
+	})
+	if g.gameMap != nil {
+		g.spawned[name] = true
+		g.sendAsync(&UserMoveEvent{
+			playerInfo: &playerInfo{
+				name:   name,
+				avatar: avatar,
+				pos:    g.randomSpawn(),
+				alive:  true,
+			},
+		})
+	}
+	log.Infof("[addRemotePlayer] %s joined", name)
+	return a
+}
+
+// sendInput send the intent of a player of a remote client to the server,
+// held directions are only sent when they change
+func (g *Game) sendInput(name string, in intent) {
+	last, sent := g.sentInputs[name]
+	if sent && sameDirections(last.held, in.held) && in.pressed == dirNone &&
+		!in.bomb && !in.detonate && !in.revive {
+		return
+	}
+	g.sentInputs[name] = in
+	g.sendAsync(&InputEvent{
+		name:   name,
+		avatar: g.nameToPlayers[name].avatar,
+		in:     in,
+	})
+}
+
+// sameDirections reports whether the same directions are held in a and b
+func sameDirections(a, b map[Direction]bool) bool {
+	count := 0
+	for dir, held := range a {
+		if held {
+			if !b[dir] {
+				return false
+			}
+			count++
+		}
+	}
+	for _, held := range b {
+		if held {
+			count--
+		}
+	}
+	return count == 0
+}
+
+// newServer create the authoritative game of a room, it plays every player
+// from the input topic at the speed of options and publishes what happens to the event topic
+func newServer(roomName string, options roomOptions, cfg *config) *Game {
+	g := newGameState(cfg, realClock{}, time.Now().UnixNano())
+	g.server = true
+	g.speed = clampSpeed(options.speed)
+	g.client = newRoomClient(roomName, serverName, options)
+	g.client.server = true
+	g.client.subscribeInputs()
+
+	g.sendCh = make(chan Event, serverSendQueueSize)
+	g.eventCh = g.client.start(g.sendCh)
+	go g.client.runScorer(cfg.Scoring)
+	return g
+}
+
+// validDirection convert a direction received from pulsar, unknown directions are dirNone
+func validDirection(d int) Direction {
+	if d < int(dirNone) || d > int(dirUp) {
+		return dirNone
+	}
+	return Direction(d)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestServerSendsEveryEvent(t *testing.T) {
+	g := newGameState(defaultConfig(), newSimClock(), 1)
+	g.server = true
+	g.speed = defaultSpeed
+	g.gameMap = &GameMap{Width: 10, Height: 10, Spawns: []Position{{X: 1, Y: 1}}}
+	g.sendCh = make(chan Event, serverSendQueueSize)
+
+	// every new player joins and moves to a spawn, far more events than the queue holds
+	players := 3 * serverSendQueueSize
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < players; i++ {
+			name := fmt.Sprintf("p%d", i)
+			(&InputEvent{name: name, avatar: defaultAvatar, sender: name}).handle(g)
+		}
+		close(done)
+	}()
+	// nothing is sent for a while, the queue fills up
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+
+	for i := 0; i < players; i++ {
+		name := fmt.Sprintf("p%d", i)
+		for _, want := range []string{"join", "move"} {
+			var event Event
+			select {
+			case event = <-g.sendCh:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("the %s event of %s is lost", want, name)
+			}
+			switch e := event.(type) {
+			case *UserJoinEvent:
+				if want != "join" || e.name != name {
+					t.Fatalf("join of %s, want the %s event of %s", e.name, want, name)
+				}
+			case *UserMoveEvent:
+				if want != "move" || e.name != name || e.pos != (Position{X: 1, Y: 1}) {
+					t.Fatalf("move of %s to %v, want the %s event of %s", e.name, e.pos, want, name)
+				}
+			default:
+				t.Fatalf("%T, want the %s event of %s", event, want, name)
+			}
+		}
+	}
+}
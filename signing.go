@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	log "github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// signatureProperty of a message is the signature of its room, sender, sequence number and value
+	signatureProperty = "signature"
+	// sequenceProperty of a message grows with every message signed by a client
+	sequenceProperty = "sequence"
+	// the key of a sender without one is looked up again after unknownKeyRetry
+	unknownKeyRetry = time.Minute
+	// keys of new senders read every second at most
+	keyReadsPerSecond = 10
+	// the durable subscription of every key topic, it keeps the keys published forever
+	keyKeeperSubscription = "key-keeper"
+)
+
+// getKeyTopicName: the key of a player is the first message of its key topic, in every room.
+// With authorization, only the role of the player is allowed to produce to it,
+// which needs a namespace of its own.
+func (c *pulsarClient) getKeyTopicName(playerName string) string {
+	if c.keyNamespace != "" {
+		return "persistent://" + c.keyNamespace + "/player-key-" + playerName
+	}
+	return "player-key-" + playerName
+}
+
+// keyPath is where the key of a player is saved, a player keeps its key between games
+func keyPath(playerName string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pulsar-game", "keys", playerName+".key"), nil
+}
+
+// loadKey read the private key of a player, a new one is created the first time
+func loadKey(playerName string) (ed25519.PrivateKey, error) {
+	path, err := keyPath(playerName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid key file %s", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key.Seed())), 0600)
+	return key, err
+}
+
+// publishKey load the key of a player of this client and publish its public key,
+// unless its key topic has one already, which must be the same key
+func (c *pulsarClient) publishKey(playerName string) error {
+	key, err := loadKey(playerName)
+	if err != nil {
+		return err
+	}
+	public := key.Public().(ed25519.PublicKey)
+	c.keyLock.Lock()
+	defer c.keyLock.Unlock()
+	known, err := c.readKey(playerName)
+	if err != nil {
+		return err
+	}
+	if known == nil {
+		if err = c.sendKey(playerName, public); err != nil {
+			return err
+		}
+		// another client may have published first
+		if known, err = c.readKey(playerName); err != nil {
+			return err
+		}
+	}
+	if !public.Equal(known) {
+		return fmt.Errorf("%s has another key, the name is taken", playerName)
+	}
+	c.privateKeys[playerName] = key
+	c.publicKeys[playerName] = public
+	return nil
+}
+
+// sendKey publish the public key of a player to its key topic
+func (c *pulsarClient) sendKey(playerName string, key ed25519.PublicKey) error {
+	// the messages of a topic without subscription are not kept
+	keeper, err := c.client.Subscribe(pulsar.ConsumerOptions{
+		Topic:                       c.getKeyTopicName(playerName),
+		SubscriptionName:            keyKeeperSubscription,
+		Type:                        pulsar.Shared,
+		SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
+	})
+	if err != nil {
+		return err
+	}
+	keeper.Close()
+
+	producer, err := c.client.CreateProducer(pulsar.ProducerOptions{
+		Topic: c.getKeyTopicName(playerName),
+	})
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+	_, err = producer.Send(context.Background(), &pulsar.ProducerMessage{
+		Payload: []byte(base64.StdEncoding.EncodeToString(key)),
+	})
+	return err
+}
+
+// readKey read the first key published for a player, nil if there is none
+func (c *pulsarClient) readKey(playerName string) (ed25519.PublicKey, error) {
+	reader, err := c.client.CreateReader(pulsar.ReaderOptions{
+		Topic:          c.getKeyTopicName(playerName),
+		StartMessageID: pulsar.EarliestMessageID(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if !reader.HasNext() {
+		return nil, nil
+	}
+	msg, err := reader.Next(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(string(msg.Payload()))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid key of %s", playerName)
+	}
+	return key, nil
+}
+
+// actor is the player a message acts for, only this player can send it.
+// Bombs and their flames act for the player they are named after, pushes for the pusher.
+func (m *EventMessage) actor() string {
+	switch m.Type {
+	case UserJoinEventType, UserMoveEventType, UserDeadEventType, UserReviveEventType, ChatEventType, InputEventType:
+		return m.Name
+	case SetBombEventType, ExplodeEventType, UndoExplodeEventType:
+		return bombOwner(m.Name)
+	case MoveBombEventType:
+		return m.Pusher
+	}
+	return ""
+}
+
+// sequences are the last sequence numbers of the senders of a topic,
+// every receiver of a topic has its own
+type sequences map[string]int64
+
+// nextSequence return a number greater than every number signed by this client before,
+// it starts from the time so it goes on growing when the client restarts
+func (c *pulsarClient) nextSequence() int64 {
+	for {
+		last := c.sequence.Load()
+		next := time.Now().UnixNano()
+		if next <= last {
+			next = last + 1
+		}
+		if c.sequence.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
+
+// signedData is what is signed in a message, the room, the sender
+// and its sequence number are signed with the value
+func signedData(room, sender, sequence string, value []byte) []byte {
+	return append([]byte(room+"\n"+sender+"\n"+sequence+"\n"), value...)
+}
+
+// messageValue is the json of a message, which is signed
+func messageValue(msg *EventMessage) []byte {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		log.Error("[messageValue]", err)
+	}
+	return value
+}
+
+// sign return the properties of a message: its sender, which is the player it acts for,
+// its sequence number and the signature of the sender. The signer of the client signs the other messages.
+func (c *pulsarClient) sign(msg *EventMessage) map[string]string {
+	return c.signValue(msg.actor(), messageValue(msg))
+}
+
+// signValue return the properties of value signed by sender,
+// or by the signer of the client if it has no key of sender
+func (c *pulsarClient) signValue(sender string, value []byte) map[string]string {
+	key, ok := c.privateKeys[sender]
+	if !ok {
+		sender = c.signer
+		key = c.privateKeys[sender]
+	}
+	sequence := strconv.FormatInt(c.nextSequence(), 10)
+	return map[string]string{
+		senderProperty:    sender,
+		sequenceProperty:  sequence,
+		signatureProperty: base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedData(c.roomName, sender, sequence, value))),
+	}
+}
+
+// verify check that the sender of a message is the player it acts for, the server of the room
+// acts for every player, and check the signature with the first key published for the sender.
+// The sequence number of the sender must be greater than the last one in seen, messages are not replayed.
+func (c *pulsarClient) verify(msg *EventMessage, properties map[string]string, seen sequences) error {
+	sender := properties[senderProperty]
+	if sender == "" {
+		return errors.New("no sender")
+	}
+	if actor := msg.actor(); actor != "" && actor != sender &&
+		!((c.server || c.remote) && sender == c.getServerProducerName()) {
+		return fmt.Errorf("%s can't act for %s", sender, actor)
+	}
+	sequence, err := c.verifySignature(c.roomName, properties, messageValue(msg))
+	if err != nil {
+		return err
+	}
+	if sequence <= seen[sender] {
+		return fmt.Errorf("replayed message of %s", sender)
+	}
+	seen[sender] = sequence
+	return nil
+}
+
+// verifySignature check the signature of value sent to room with the first key published
+// for its sender, and return its sequence number
+func (c *pulsarClient) verifySignature(room string, properties map[string]string, value []byte) (int64, error) {
+	sender := properties[senderProperty]
+	if sender == "" {
+		return 0, errors.New("no sender")
+	}
+	signature, err := base64.StdEncoding.DecodeString(properties[signatureProperty])
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return 0, errors.New("no signature")
+	}
+	sequence, err := strconv.ParseInt(properties[sequenceProperty], 10, 64)
+	if err != nil {
+		return 0, errors.New("no sequence number")
+	}
+	key, err := c.publicKey(sender)
+	if err != nil {
+		return 0, err
+	}
+	if !ed25519.Verify(key, signedData(room, sender, properties[sequenceProperty], value), signature) {
+		return 0, fmt.Errorf("bad signature of %s", sender)
+	}
+	return sequence, nil
+}
+
+// publicKey return the key of sender, read from its key topic the first time. Senders without a key
+// are looked up again after unknownKeyRetry, and keyReadsPerSecond keys at most are read.
+func (c *pulsarClient) publicKey(sender string) (ed25519.PublicKey, error) {
+	c.keyLock.Lock()
+	defer c.keyLock.Unlock()
+	if key, ok := c.publicKeys[sender]; ok {
+		return key, nil
+	}
+	now := time.Now()
+	if t, ok := c.unknownKeys[sender]; ok && now.Sub(t) < unknownKeyRetry {
+		return nil, fmt.Errorf("unknown key of %s", sender)
+	}
+	if now.Sub(c.keyReadsSince) >= time.Second {
+		c.keyReads, c.keyReadsSince = 0, now
+	}
+	if c.keyReads >= keyReadsPerSecond {
+		return nil, fmt.Errorf("too many keys to read, the key of %s is not read", sender)
+	}
+	c.keyReads++
+	key, err := c.readKey(sender)
+	if err != nil {
+		c.unknownKeys[sender] = now
+		return nil, err
+	}
+	if key == nil {
+		c.unknownKeys[sender] = now
+		return nil, fmt.Errorf("unknown key of %s", sender)
+	}
+	delete(c.unknownKeys, sender)
+	c.publicKeys[sender] = key
+	return key, nil
+}
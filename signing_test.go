@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"testing"
+	"time"
+)
+
+// testClient is a client of room r with keys for names, the first name signs for nobody
+func testClient(t *testing.T, server, remote bool, names ...string) *pulsarClient {
+	c := &pulsarClient{
+		roomName:    "r",
+		server:      server,
+		remote:      remote,
+		signer:      names[0],
+		privateKeys: map[string]ed25519.PrivateKey{},
+		publicKeys:  map[string]ed25519.PublicKey{},
+		unknownKeys: map[string]time.Time{},
+	}
+	for _, name := range names {
+		public, private, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.privateKeys[name] = private
+		c.publicKeys[name] = public
+	}
+	return c
+}
+
+func TestVerify(t *testing.T) {
+	alice := testClient(t, false, false, "alice", "alice2")
+	mallory := testClient(t, false, false, "mallory")
+	server := testClient(t, true, false, "r-server")
+	peer := testClient(t, false, false, "peer")
+	remote := testClient(t, false, true, "viewer")
+	for _, c := range []*pulsarClient{alice, mallory, server} {
+		for name, key := range c.publicKeys {
+			peer.publicKeys[name] = key
+			remote.publicKeys[name] = key
+			server.publicKeys[name] = key
+		}
+	}
+
+	tests := []struct {
+		name     string
+		from, to *pulsarClient
+		msg      EventMessage
+		ok       bool
+	}{
+		{"own move", alice, peer, EventMessage{Type: UserMoveEventType, Name: "alice"}, true},
+		{"second local player", alice, peer, EventMessage{Type: UserMoveEventType, Name: "alice2"}, true},
+		{"death of another player", mallory, peer, EventMessage{Type: UserDeadEventType, Name: "alice", Comment: "mallory"}, false},
+		{"bomb of another player", mallory, peer, EventMessage{Type: SetBombEventType, Name: "alice-abcde"}, false},
+		{"own bomb", mallory, peer, EventMessage{Type: SetBombEventType, Name: "mallory-abcde"}, true},
+		{"random bomb", mallory, peer, EventMessage{Type: SetBombEventType, Name: "random-abcde"}, false},
+		{"push of another bomb", mallory, peer, EventMessage{Type: MoveBombEventType, Name: "alice-abcde", Pusher: "mallory"}, true},
+		{"push as another player", mallory, peer, EventMessage{Type: MoveBombEventType, Name: "alice-abcde", Pusher: "alice"}, false},
+		{"chat as another player", mallory, peer, EventMessage{Type: ChatEventType, Name: "alice"}, false},
+		{"input of another player", mallory, server, EventMessage{Type: InputEventType, Name: "alice"}, false},
+		{"own input", alice, server, EventMessage{Type: InputEventType, Name: "alice"}, true},
+		{"server without server", server, peer, EventMessage{Type: UserMoveEventType, Name: "alice"}, false},
+		{"server of a remote client", server, remote, EventMessage{Type: UserMoveEventType, Name: "alice"}, true},
+		{"flames of another player", mallory, peer, EventMessage{Type: UndoExplodeEventType, Name: "alice-abcde"}, false},
+		{"own flames", mallory, peer, EventMessage{Type: UndoExplodeEventType, Name: "mallory-abcde"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			properties := tt.from.sign(&tt.msg)
+			if err := tt.to.verify(&tt.msg, properties, sequences{}); (err == nil) != tt.ok {
+				t.Errorf("verify = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	alice := testClient(t, false, false, "alice")
+	peer := testClient(t, false, false, "peer")
+	peer.publicKeys["alice"] = alice.publicKeys["alice"]
+
+	msg := EventMessage{Type: UserMoveEventType, Name: "alice", X: 1}
+	properties := alice.sign(&msg)
+	msg.X = 5
+	if err := peer.verify(&msg, properties, sequences{}); err == nil {
+		t.Error("a changed message is verified")
+	}
+	msg.X = 1
+	delete(properties, signatureProperty)
+	if err := peer.verify(&msg, properties, sequences{}); err == nil {
+		t.Error("an unsigned message is verified")
+	}
+}
+
+func TestVerifyReplayed(t *testing.T) {
+	alice := testClient(t, false, false, "alice")
+	peer := testClient(t, false, false, "peer")
+	peer.publicKeys["alice"] = alice.publicKeys["alice"]
+	seen := sequences{}
+
+	bomb := EventMessage{Type: SetBombEventType, Name: "alice-abcde", X: 1}
+	first := alice.sign(&bomb)
+	if err := peer.verify(&bomb, first, seen); err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.verify(&bomb, first, seen); err == nil {
+		t.Error("a replayed bomb is verified")
+	}
+	if err := peer.verify(&bomb, alice.sign(&bomb), seen); err != nil {
+		t.Errorf("the next bomb: %v", err)
+	}
+	if err := peer.verify(&bomb, first, sequences{}); err != nil {
+		t.Errorf("another topic: %v", err)
+	}
+
+	first[sequenceProperty] += "0"
+	if err := peer.verify(&bomb, first, seen); err == nil {
+		t.Error("a message with a changed sequence number is verified")
+	}
+	other := testClient(t, false, false, "alice")
+	other.roomName = "other"
+	other.privateKeys["alice"] = alice.privateKeys["alice"]
+	if err := peer.verify(&bomb, other.sign(&bomb), seen); err == nil {
+		t.Error("a message of another room is verified")
+	}
+}
+
+// keyReader is a pulsar client which has no key, it counts the keys read
+type keyReader struct {
+	pulsar.Client
+	reads int
+}
+
+func (c *keyReader) CreateReader(pulsar.ReaderOptions) (pulsar.Reader, error) {
+	c.reads++
+	return nil, errors.New("no key topic")
+}
+
+func TestVerifyUnknownSenders(t *testing.T) {
+	mallory := testClient(t, false, false, "mallory")
+	peer := testClient(t, false, false, "peer")
+	reader := &keyReader{}
+	peer.client = reader
+
+	msg := EventMessage{Type: UserMoveEventType, Name: "mallory"}
+	for i := 0; i < 3; i++ {
+		if err := peer.verify(&msg, mallory.sign(&msg), sequences{}); err == nil {
+			t.Fatal("a message of an unknown sender is verified")
+		}
+	}
+	if reader.reads != 1 {
+		t.Errorf("the key of an unknown sender read %d times, want once", reader.reads)
+	}
+
+	for i := 0; i < 10*keyReadsPerSecond; i++ {
+		msg := EventMessage{Type: UserMoveEventType, Name: fmt.Sprintf("new%d", i)}
+		mallory.privateKeys[msg.Name] = mallory.privateKeys["mallory"]
+		peer.verify(&msg, mallory.sign(&msg), sequences{})
+	}
+	if reader.reads > keyReadsPerSecond {
+		t.Errorf("%d keys read for a flood of new names, want %d at most", reader.reads, keyReadsPerSecond)
+	}
+}
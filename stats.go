@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"image/color"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var scoreboardColor = color.RGBA{A: 0xc0}
+
+// playerStats are counted by every client from the events of the room
+type playerStats struct {
+	// points by the score rules of the config
+	points   int
+	kills    int
+	assists  int
+	deaths   int
+	suicides int
+	bombs    int
+	blocks   int
+	// events of the player's client dropped because they broke the rules
+	suspicious int
+}
+
+// kd is kills per death, deathless players count one death
+func (s *playerStats) kd() float64 {
+	if s.deaths == 0 {
+		return float64(s.kills)
+	}
+	return float64(s.kills) / float64(s.deaths)
+}
+
+// stats of a player, created on first use
+func (g *Game) stats(name string) *playerStats {
+	s, ok := g.playerStats[name]
+	if !ok {
+		s = &playerStats{}
+		g.playerStats[name] = s
+	}
+	return s
+}
+
+// scoring of the room, the config's until a map brings the rules of the room
+func (g *Game) scoring() scoreRules {
+	if g.roomScoring != nil {
+		return *g.roomScoring
+	}
+	return g.config.Scoring
+}
+
+// recordDeath count the death of victim, the bomb was set by killer and pushed last by pusher
+func (g *Game) recordDeath(victim, killer, pusher string) {
+	rules := g.scoring()
+	g.stats(victim).deaths++
+	credited, assist := rules.killer(victim, killer, pusher)
+	switch credited {
+	case "":
+	case victim:
+		g.stats(victim).suicides++
+	default:
+		g.stats(credited).kills++
+	}
+	if assist != "" {
+		g.stats(assist).assists++
+	}
+	for name, p := range rules.credit(victim, killer, pusher) {
+		g.stats(name).points += p
+	}
+}
+
+// score of a player, the score topic of the room wins over the local points
+func (g *Game) score(name string) int {
+	g.scoreLock.RLock()
+	defer g.scoreLock.RUnlock()
+	if s, ok := g.scores[name]; ok {
+		if score, err := strconv.Atoi(s); err == nil {
+			return score
+		}
+	}
+	if s, ok := g.playerStats[name]; ok {
+		return s.points
+	}
+	return 0
+}
+
+// rankedPlayers are every player seen in the room, by score then name
+func (g *Game) rankedPlayers() []string {
+	seen := map[string]bool{}
+	for name := range g.nameToPlayers {
+		seen[name] = true
+	}
+	for name := range g.playerStats {
+		seen[name] = true
+	}
+	g.scoreLock.RLock()
+	for name := range g.scores {
+		seen[name] = true
+	}
+	g.scoreLock.RUnlock()
+	delete(seen, "random")
+
+	names := make([]string, 0, len(seen))
+	scores := map[string]int{}
+	for name := range seen {
+		names = append(names, name)
+		scores[name] = g.score(name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if scores[names[i]] != scores[names[j]] {
+			return scores[names[i]] > scores[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// drawScoreboard print the stats of every player over the view
+func (r *renderer) drawScoreboard(g *Game, screen *ebiten.Image) {
+	ebitenutil.DrawRect(screen, 0, 0, viewWidth, viewHeight, scoreboardColor)
+	const format = "%-14s %6s %5s %6s %8s %5s %5s %6s %6s %10s"
+	lines := []string{
+		fmt.Sprintf(format, "player", "score", "kills", "deaths", "suicides", "K/D", "bombs", "blocks", "ping", "suspicious"),
+	}
+	for _, name := range g.rankedPlayers() {
+		// read only, players are not added while drawing
+		s, ok := g.playerStats[name]
+		if !ok {
+			s = &playerStats{}
+		}
+		ping := "-"
+		if d, ok := g.client.ping(name); ok {
+			ping = strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+		}
+		lines = append(lines, fmt.Sprintf(format, truncate(name, 14), strconv.Itoa(g.score(name)),
+			strconv.Itoa(s.kills), strconv.Itoa(s.deaths), strconv.Itoa(s.suicides),
+			strconv.FormatFloat(s.kd(), 'f', 2, 64), strconv.Itoa(s.bombs), strconv.Itoa(s.blocks), ping,
+			strconv.Itoa(s.suspicious)))
+	}
+	y := debugCharHeight
+	for _, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, debugCharWidth, y)
+		y += debugCharHeight
+		if y > viewHeight-debugCharHeight {
+			break
+		}
+	}
+}
+
+// truncate cut s to n characters
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+const (
+	// pingSmoothing is the weight of a new sample in the ping average
+	pingSmoothing = 0.2
+	// sentProperty of a message is when this client sent it, in nanoseconds
+	sentProperty = "sent"
+	// pingProperty of a message is the ping of its sender, in nanoseconds
+	pingProperty = "ping"
+)
+
+// addPing add the properties of the ping to a message sent, the server sends the events
+// of remote players, its ping is not theirs
+func (c *pulsarClient) addPing(properties map[string]string) {
+	if c.server {
+		return
+	}
+	properties[sentProperty] = strconv.FormatInt(time.Now().UnixNano(), 10)
+	c.pingLock.RLock()
+	defer c.pingLock.RUnlock()
+	if c.roundTrip > 0 {
+		properties[pingProperty] = strconv.FormatInt(int64(c.roundTrip), 10)
+	}
+}
+
+// receivePing update the ping of the player of a message. The ping of a client is the round
+// trip of its messages to the broker and back, measured with their send time on its own clock,
+// the other clients know it from the messages it sends.
+func (c *pulsarClient) receivePing(msg pulsar.Message, name string) {
+	properties := msg.Properties()
+	c.pingLock.Lock()
+	defer c.pingLock.Unlock()
+	if c.pings == nil {
+		c.pings = map[string]time.Duration{}
+	}
+	if msg.ProducerName() == c.producer.Name() {
+		sent, err := strconv.ParseInt(properties[sentProperty], 10, 64)
+		if err != nil {
+			return
+		}
+		delay := time.Since(time.Unix(0, sent))
+		if c.roundTrip > 0 {
+			delay = c.roundTrip + time.Duration(float64(delay-c.roundTrip)*pingSmoothing)
+		}
+		c.roundTrip = delay
+		c.pings[name] = delay
+		return
+	}
+	if ping, err := strconv.ParseInt(properties[pingProperty], 10, 64); err == nil && ping > 0 {
+		c.pings[name] = time.Duration(ping)
+	}
+}
+
+// ping of a player, false if no message of the player was received
+func (c *pulsarClient) ping(name string) (time.Duration, bool) {
+	c.pingLock.RLock()
+	defer c.pingLock.RUnlock()
+	d, ok := c.pings[name]
+	return d, ok
+}
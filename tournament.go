@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// a match nobody wins in matchTimeLimit is a draw
+	matchTimeLimit = 3 * time.Minute
+	// simulations tick like the ebiten game loop, but as fast as they can
+	simTick = time.Second / ebiten.DefaultTPS
+)
+
+// tournamentOptions describe the matches to run
+type tournamentOptions struct {
+	matches int
+	// every match has a bot of every strategy, a strategy is a bot difficulty
+	strategies []string
+	generator  string
+	size       mapSize
+	// seed of the first match, the next matches use the next seeds
+	seed int64
+}
+
+// matchResult is a line of the report for every match
+type matchResult struct {
+	Match int   `json:"match"`
+	Seed  int64 `json:"seed"`
+	// strategy of the last bot alive, empty for a draw
+	Winner   string  `json:"winner"`
+	Duration float64 `json:"durationSeconds"`
+}
+
+// strategyResult sum the matches of a strategy
+type strategyResult struct {
+	Strategy string `json:"strategy"`
+	// how many bots of the strategy played, a strategy may play several bots in a match
+	Bots          int     `json:"bots"`
+	Wins          int     `json:"wins"`
+	WinRate       float64 `json:"winRate"`
+	AvgSurvival   float64 `json:"avgSurvivalSeconds"`
+	Kills         int     `json:"kills"`
+	KillsPerMatch float64 `json:"killsPerMatch"`
+
+	survival time.Duration
+}
+
+type tournamentReport struct {
+	Strategies []*strategyResult `json:"strategies"`
+	Matches    []matchResult     `json:"matches"`
+}
+
+// runTournament play the matches one by one
+func runTournament(options tournamentOptions, cfg *config) *tournamentReport {
+	report := &tournamentReport{}
+	results := map[string]*strategyResult{}
+	for _, strategy := range options.strategies {
+		if _, ok := results[strategy]; !ok {
+			results[strategy] = &strategyResult{Strategy: strategy}
+			report.Strategies = append(report.Strategies, results[strategy])
+		}
+	}
+
+	for i := 0; i < options.matches; i++ {
+		seed := options.seed + int64(i)
+		match, bots := runMatch(options, seed, cfg)
+		match.Match = i + 1
+		report.Matches = append(report.Matches, match)
+		for _, b := range bots {
+			r := results[b.strategy]
+			r.Bots++
+			r.survival += b.survival
+			r.Kills += b.kills
+		}
+		if match.Winner != "" {
+			results[match.Winner].Wins++
+		}
+		fmt.Fprintf(os.Stderr, "match %d: winner %q after %.1fs\n", match.Match, match.Winner, match.Duration)
+	}
+
+	for _, r := range report.Strategies {
+		if options.matches > 0 {
+			r.WinRate = float64(r.Wins) / float64(options.matches)
+			r.KillsPerMatch = float64(r.Kills) / float64(options.matches)
+		}
+		if r.Bots > 0 {
+			r.AvgSurvival = (r.survival / time.Duration(r.Bots)).Seconds()
+		}
+	}
+	return report
+}
+
+// botOutcome is how a bot did in a match
+type botOutcome struct {
+	strategy string
+	survival time.Duration
+	kills    int
+}
+
+// runMatch play a match until one bot is alive or matchTimeLimit passed
+func runMatch(options tournamentOptions, seed int64, cfg *config) (matchResult, []botOutcome) {
+	gameMap, err := generateMap(options.generator, seed, options.size.width, options.size.height)
+	if err != nil {
+		log.Fatal("[runMatch]", err)
+	}
+	var players []playerOptions
+	for i, strategy := range options.strategies {
+		players = append(players, playerOptions{
+			name:   fmt.Sprintf("bot%d", i+1),
+			avatar: defaultAvatar,
+			bot:    strategy,
+		})
+	}
+	clk := newSimClock()
+	g := newSimGame(players, cfg, clk, seed)
+	g.elimination = true
+	g.sendAsync(&UpdateMapEvent{
+		Obstacles: gameMap.obstacleCodes(),
+		gameMap:   gameMap,
+	})
+
+	start := clk.Now()
+	diedAt := map[string]time.Duration{}
+	for clk.Now().Sub(start) < matchTimeLimit {
+		g.drainEvents()
+		if err := g.Update(); err != nil {
+			log.Fatal("[runMatch]", err)
+		}
+		clk.advance(simTick)
+		alive := 0
+		for _, b := range g.bots {
+			if g.nameToPlayers[b.name].alive {
+				alive++
+			} else if _, ok := diedAt[b.name]; !ok {
+				diedAt[b.name] = clk.Now().Sub(start)
+			}
+		}
+		if alive <= 1 {
+			break
+		}
+	}
+	// the last deaths are counted
+	g.drainEvents()
+
+	duration := clk.Now().Sub(start)
+	result := matchResult{Seed: seed, Duration: duration.Seconds()}
+	var outcomes []botOutcome
+	alive := 0
+	for i, b := range g.bots {
+		survival, dead := diedAt[b.name]
+		if !dead {
+			survival = duration
+			alive++
+			result.Winner = options.strategies[i]
+		}
+		outcomes = append(outcomes, botOutcome{
+			strategy: options.strategies[i],
+			survival: survival,
+			kills:    g.stats(b.name).kills,
+		})
+	}
+	if alive != 1 {
+		result.Winner = ""
+	}
+	return result, outcomes
+}
+
+// write the report as json if path ends with .json, otherwise as csv, to stdout if path is empty
+func (r *tournamentReport) write(path string) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if filepath.Ext(path) == ".json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	c := csv.NewWriter(w)
+	c.Write([]string{"strategy", "bots", "wins", "win_rate", "avg_survival_seconds", "kills", "kills_per_match"})
+	for _, s := range r.Strategies {
+		c.Write([]string{
+			s.Strategy,
+			strconv.Itoa(s.Bots),
+			strconv.Itoa(s.Wins),
+			strconv.FormatFloat(s.WinRate, 'f', 3, 64),
+			strconv.FormatFloat(s.AvgSurvival, 'f', 1, 64),
+			strconv.Itoa(s.Kills),
+			strconv.FormatFloat(s.KillsPerMatch, 'f', 2, 64),
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
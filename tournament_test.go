@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// simAgents play a map with agents, events loop back and the clock moves a tick at a time
+type simAgents struct {
+	t   *testing.T
+	g   *Game
+	clk *simClock
+}
+
+func newSimAgents(t *testing.T, gameMap *GameMap, names ...string) *simAgents {
+	var players []playerOptions
+	for _, name := range names {
+		players = append(players, playerOptions{name: name, avatar: defaultAvatar, speed: defaultSpeed, agent: true})
+	}
+	clk := newSimClock()
+	s := &simAgents{t: t, g: newSimGame(players, defaultConfig(), clk, 1), clk: clk}
+	s.g.sendAsync(&UpdateMapEvent{Obstacles: gameMap.obstacleCodes(), gameMap: gameMap})
+	s.tick()
+	return s
+}
+
+func (s *simAgents) tick() {
+	s.g.drainEvents()
+	if err := s.g.Update(); err != nil {
+		s.t.Fatal(err)
+	}
+	s.clk.advance(simTick)
+	s.g.drainEvents()
+}
+
+// place move a player to pos at once
+func (s *simAgents) place(name string, pos Position) {
+	s.g.sendAsync(&UserMoveEvent{playerInfo: &playerInfo{name: name, avatar: defaultAvatar, pos: pos, alive: true}})
+	s.tick()
+}
+
+// do the gym action with the agent name until it is at pos, or for a tick without pos
+func (s *simAgents) do(name, action string, pos *Position) {
+	for _, a := range s.g.agents {
+		if a.name == name {
+			a.next = gymActions[action]
+		}
+	}
+	// a second at most
+	for i := 0; i < int(time.Second/simTick); i++ {
+		s.tick()
+		if pos == nil || s.g.nameToPlayers[name].pos == *pos {
+			return
+		}
+	}
+	s.t.Fatalf("%s did not get to %v but %v", name, *pos, s.g.nameToPlayers[name].pos)
+}
+
+func (s *simAgents) wait(d time.Duration) {
+	for end := s.clk.Now().Add(d); s.clk.Now().Before(end); {
+		s.tick()
+	}
+}
+
+func TestSimBomb(t *testing.T) {
+	gameMap := &GameMap{
+		Width:  12,
+		Height: 3,
+		// flames stop at walls and burn through blocks within bombLength
+		Walls:  []Position{{X: 2, Y: 0}},
+		Blocks: []Position{{X: 2, Y: 2}, {X: 8, Y: 1}, {X: 11, Y: 1}},
+		Spawns: []Position{{X: 0, Y: 0}},
+	}
+	s := newSimAgents(t, gameMap, "alice", "bob")
+	s.place("alice", Position{X: 2, Y: 1})
+	s.place("bob", Position{X: 6, Y: 1})
+
+	s.do("alice", "bomb", nil)
+	s.do("alice", "left", &Position{X: 1, Y: 1})
+	s.do("alice", "up", &Position{X: 1, Y: 0})
+	s.do("alice", "stay", nil)
+	s.wait(explodeTime*time.Second + time.Second)
+
+	g := s.g
+	if !g.nameToPlayers["alice"].alive || g.nameToPlayers["bob"].alive {
+		t.Fatalf("alive: alice %v, bob %v, want alice only", g.nameToPlayers["alice"].alive, g.nameToPlayers["bob"].alive)
+	}
+	alice, bob := g.stats("alice"), g.stats("bob")
+	if alice.kills != 1 || alice.bombs != 1 || alice.blocks != 2 || alice.points != 1 {
+		t.Errorf("alice %+v, want 1 kill with 1 bomb and 2 blocks", *alice)
+	}
+	if bob.deaths != 1 || bob.points != 0 {
+		t.Errorf("bob %+v, want 1 death", *bob)
+	}
+	want := map[Position]ObstacleType{
+		{X: 2, Y: 0}:  indestructibleObstacleType,
+		{X: 11, Y: 1}: destructibleObstacleType,
+	}
+	if !reflect.DeepEqual(g.obstacleMap, want) {
+		t.Errorf("obstacles %v, want %v", g.obstacleMap, want)
+	}
+}
+
+func TestMatchSeeded(t *testing.T) {
+	options := tournamentOptions{
+		strategies: []string{"easy", "hard"},
+		generator:  "classic",
+		size:       mapSize{width: 15, height: 11},
+	}
+	first, firstBots := runMatch(options, 7, defaultConfig())
+	second, secondBots := runMatch(options, 7, defaultConfig())
+	if first.Duration == 0 || first != second || !reflect.DeepEqual(firstBots, secondBots) {
+		t.Errorf("the same seed played differently: %+v %+v, then %+v %+v", first, firstBots, second, secondBots)
+	}
+}
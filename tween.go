@@ -0,0 +1,51 @@
+package main
+
+import "time"
+
+const (
+	// the local player moves immediately, so its tween is short
+	localMoveDuration = 100 * time.Millisecond
+	// remote players move a bit slower to hide network jitter
+	remoteMoveDuration = 180 * time.Millisecond
+	// a pushed bomb moves a grid every bombMoveDuration
+	bombMoveDuration = time.Second / 2
+)
+
+// tween moves an entity smoothly from where it is to its target grid,
+// game logic only knows the target, the renderer draws the position in between
+type tween struct {
+	// where the tween starts, in grids
+	fromX, fromY float64
+	to           Position
+	start        time.Time
+	duration     time.Duration
+}
+
+func newTween(pos Position) *tween {
+	return &tween{fromX: float64(pos.X), fromY: float64(pos.Y), to: pos}
+}
+
+// moveTo start moving from the current position, a target more than one grid away is a teleport
+func (t *tween) moveTo(pos Position, now time.Time, duration time.Duration) {
+	x, y := t.at(now)
+	if abs(pos.X-t.to.X)+abs(pos.Y-t.to.Y) > 1 {
+		// spawn or revive
+		x, y = float64(pos.X), float64(pos.Y)
+	}
+	t.fromX, t.fromY = x, y
+	t.to = pos
+	t.start = now
+	t.duration = duration
+}
+
+// at is the position in grids at now
+func (t *tween) at(now time.Time) (float64, float64) {
+	k := 1.0
+	if t.duration > 0 {
+		k = float64(now.Sub(t.start)) / float64(t.duration)
+	}
+	if k > 1 {
+		k = 1
+	}
+	return t.fromX + (float64(t.to.X)-t.fromX)*k, t.fromY + (float64(t.to.Y)-t.fromY)*k
+}
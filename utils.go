@@ -3,15 +3,17 @@ package main
 import (
 	"image/color"
 	"math/rand"
+	"sync"
+	"time"
 )
 
 var (
-	playerColor                 = color.RGBA{R: 0xFF, A: 0xff, G: 0x34}
-	deadPlayerColor             = color.RGBA{R: 0xeb, A: 0xc4, G: 0x40}
-	bombColor                   = color.RGBA{R: 218, G: 165, B: 32, A: 0xff}
-	flameColor                  = color.RGBA{R: 255, G: 215, B: 0, A: 0xaf}
 	destructibleObstacleColor   = color.Gray{Y: 90}
 	indestructibleObstacleColor = color.White
+	spawnColor                  = color.RGBA{R: 0x40, G: 0x80, B: 0xff, A: 0xff}
+	itemSpawnerColor            = color.RGBA{R: 0xc0, G: 0x40, B: 0xc0, A: 0xff}
+	outsideMapColor             = color.Gray{Y: 30}
+	localPlayerHighlightColor   = color.RGBA{R: 0xff, G: 0xff, B: 0x80, A: 0x80}
 )
 
 type playerInfo struct {
@@ -32,7 +34,15 @@ const (
 	dirUp
 )
 
-func getNextPosition(position Position, direction Direction) Position {
+// mapSize is the number of grids of a map
+type mapSize struct {
+	width, height int
+}
+
+// defaultMapSize fills exactly one screen
+var defaultMapSize = mapSize{width: xGridCountInScreen, height: yGridCountInScreen}
+
+func (s mapSize) getNextPosition(position Position, direction Direction) Position {
 	f := map[Direction]func(int, int) (int, int){
 		dirLeft: func(x int, y int) (int, int) {
 			return x - 1, y
@@ -52,14 +62,14 @@ func getNextPosition(position Position, direction Direction) Position {
 	}
 	x, y := f[direction](position.X, position.Y)
 	res := Position{X: x, Y: y}
-	if validCoordinate(res) {
+	if s.validCoordinate(res) {
 		return res
 	}
 	return position
 }
 
-func validCoordinate(pos Position) bool {
-	return pos.X >= 0 && pos.Y >= 0 && pos.X < xGridCountInScreen && pos.Y < yGridCountInScreen
+func (s mapSize) validCoordinate(pos Position) bool {
+	return pos.X >= 0 && pos.Y >= 0 && pos.X < s.width && pos.Y < s.height
 }
 
 type Position struct {
@@ -71,8 +81,28 @@ type Bomb struct {
 	// the player name
 	playerName, bombName string
 	pos                  Position
-	// when exploded, this chanel will receive a message, control bomb moving
+	// when exploded, this chanel is closed, control bomb moving
 	explodeCh chan struct{}
+	stopOnce  sync.Once
+	// when the bomb is set, for the fuse animation
+	setTime time.Time
+	// the players who pushed the bomb, in order
+	pushers []string
+}
+
+// stop close explodeCh once
+func (b *Bomb) stop() {
+	b.stopOnce.Do(func() {
+		close(b.explodeCh)
+	})
+}
+
+// lastPusher is the player who pushed the bomb last, empty if it never moved
+func (b *Bomb) lastPusher() string {
+	if len(b.pushers) == 0 {
+		return ""
+	}
+	return b.pushers[len(b.pushers)-1]
 }
 
 func randStringRunes(n int) string {
@@ -84,34 +114,10 @@ func randStringRunes(n int) string {
 	return string(b)
 }
 
-func encodeXY(x, y int) int {
-	return y*xGridCountInScreen + x
+func (s mapSize) encodeXY(x, y int) int {
+	return y*s.width + x
 }
 
-func decodeXY(code int) (int, int) {
-	return code % xGridCountInScreen, code / xGridCountInScreen
-}
-
-// sample k number in [0, n)
-func sample(n, k int) []int {
-	pickedNums := make([]int, k)
-	for i := 0; i < k; i++ {
-		pickedNums[i] = i
-	}
-	for i := k; i < n; i++ {
-		r := rand.Intn(i + 1)
-		if r < k {
-			pickedNums[r] = i
-		}
-	}
-	return pickedNums
-}
-
-func sliceContains(slice []int, p int) bool {
-	for _, e := range slice {
-		if e == p {
-			return true
-		}
-	}
-	return false
+func (s mapSize) decodeXY(code int) (int, int) {
+	return code % s.width, code / s.width
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	// senderProperty of a message is the player it acts for, who signed it
+	senderProperty = "sender"
+	// a player can make moveBurst moves at once, then moves at the speed of the room,
+	// bursts happen when messages are delayed
+	moveBurst = 4
+)
+
+// receivedEvent is an event of the event topic, it is checked before being handled
+type receivedEvent struct {
+	Event
+	sender string
+}
+
+func (e *receivedEvent) handle(g *Game) {
+	if err := g.check(e.Event, e.sender); err != nil {
+		if e.sender != "" {
+			g.stats(e.sender).suspicious++
+		}
+		log.Warnf("[receivedEvent] drop an event of %q: %v", e.sender, err)
+		return
+	}
+	e.Event.handle(g)
+}
+
+// validation is what a client knows to check the events of the other clients
+type validation struct {
+	// whether a player has moved since it joined, the first move goes to a spawn point
+	moved map[string]bool
+	// moves a player can make now, and when they were counted
+	moveTokens  map[string]float64
+	tokensTaken map[string]time.Time
+	// the map before the current one, a revive sent before the new map arrived is fine
+	previousMap *GameMap
+}
+
+func newValidation() validation {
+	return validation{
+		moved:       map[string]bool{},
+		moveTokens:  map[string]float64{},
+		tokensTaken: map[string]time.Time{},
+	}
+}
+
+// check return why an event sent by sender breaks the rules, nil if it doesn't
+func (g *Game) check(event Event, sender string) error {
+	if sender == "" {
+		return errors.New("no sender")
+	}
+	// a player sends its own events, bombs are sent by the player they are named after
+	if actor := convertEventToMsg(event).actor(); actor != "" && actor != sender {
+		return fmt.Errorf("%s can't act for %s", sender, actor)
+	}
+	switch e := event.(type) {
+	case *UserJoinEvent:
+		// players join at 0,0, the first move goes to a spawn point
+		g.validation.moved[e.name] = false
+	case *UserMoveEvent:
+		return g.checkMove(e.playerInfo)
+	case *UserReviveEvent:
+		return g.checkRevive(e.playerInfo)
+	case *UpdateMapEvent:
+		return errors.New("maps come from the map topic")
+	}
+	return nil
+}
+
+// checkMove make sure a player moves from its last position to a cell next to it,
+// while alive and not faster than the speed of the room
+func (g *Game) checkMove(info *playerInfo) error {
+	player, ok := g.nameToPlayers[info.name]
+	if !ok {
+		// joined before this client, its position is unknown
+		g.validation.moved[info.name] = true
+		return nil
+	}
+	if !player.alive {
+		return fmt.Errorf("%s moved while dead", info.name)
+	}
+	if g.validation.moved[info.name] {
+		if distance := abs(info.pos.X-player.pos.X) + abs(info.pos.Y-player.pos.Y); distance > 1 {
+			return fmt.Errorf("%s moved %d cells", info.name, distance)
+		}
+	}
+	g.validation.moved[info.name] = true
+
+	speed := g.roomSpeed
+	if speed == 0 {
+		// no rules yet, as fast as a player can be
+		speed = maxSpeed
+	}
+	now := g.clock.Now()
+	tokens, ok := g.validation.moveTokens[info.name]
+	if !ok {
+		tokens = moveBurst
+	} else {
+		tokens += now.Sub(g.validation.tokensTaken[info.name]).Seconds() * speed
+		if tokens > moveBurst {
+			tokens = moveBurst
+		}
+	}
+	g.validation.tokensTaken[info.name] = now
+	if tokens < 1 {
+		g.validation.moveTokens[info.name] = tokens
+		return fmt.Errorf("%s moved too fast", info.name)
+	}
+	g.validation.moveTokens[info.name] = tokens - 1
+	return nil
+}
+
+// checkRevive make sure a dead player revives at a spawn point, or where it died without a map
+func (g *Game) checkRevive(info *playerInfo) error {
+	player, ok := g.nameToPlayers[info.name]
+	if ok && player.alive {
+		return fmt.Errorf("%s revived while alive", info.name)
+	}
+	if g.gameMap == nil {
+		if ok && info.pos != player.pos {
+			return fmt.Errorf("%s revived away from where it died", info.name)
+		}
+		return nil
+	}
+	if !isSpawn(g.gameMap, info.pos) && !isSpawn(g.validation.previousMap, info.pos) {
+		return fmt.Errorf("%s revived at (%d, %d), not a spawn point", info.name, info.pos.X, info.pos.Y)
+	}
+	return nil
+}
+
+// isSpawn reports whether pos is a spawn point of gameMap, which may be nil
+func isSpawn(gameMap *GameMap, pos Position) bool {
+	if gameMap == nil {
+		return false
+	}
+	for _, spawn := range gameMap.Spawns {
+		if spawn == pos {
+			return true
+		}
+	}
+	return false
+}
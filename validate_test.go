@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testCheckGame is a game on a 10x10 map where alice is alive at 5,5 and has moved,
+// and bob is dead at 2,2
+func testCheckGame() (*Game, *simClock) {
+	clk := newSimClock()
+	g := newGameState(defaultConfig(), clk, 1)
+	g.gameMap = &GameMap{Width: 10, Height: 10, Spawns: []Position{{X: 0, Y: 0}, {X: 9, Y: 9}}}
+	g.size = g.gameMap.size()
+	g.nameToPlayers["alice"] = &playerInfo{name: "alice", pos: Position{X: 5, Y: 5}, alive: true}
+	g.validation.moved["alice"] = true
+	g.nameToPlayers["bob"] = &playerInfo{name: "bob", pos: Position{X: 2, Y: 2}}
+	g.validation.moved["bob"] = true
+	return g, clk
+}
+
+func move(name string, x, y int) *UserMoveEvent {
+	return &UserMoveEvent{playerInfo: &playerInfo{name: name, pos: Position{X: x, Y: y}, alive: true}}
+}
+
+func revive(name string, x, y int) *UserReviveEvent {
+	return &UserReviveEvent{playerInfo: &playerInfo{name: name, pos: Position{X: x, Y: y}, alive: true}}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender string
+		event  Event
+		// setup changes the game before the check
+		setup func(g *Game, clk *simClock)
+		ok    bool
+	}{
+		{name: "move to a cell next to it", sender: "alice", event: move("alice", 5, 6), ok: true},
+		{name: "move two cells", sender: "alice", event: move("alice", 5, 7)},
+		{name: "move diagonally", sender: "alice", event: move("alice", 6, 6)},
+		{name: "stay", sender: "alice", event: move("alice", 5, 5), ok: true},
+		{
+			name: "first move to a spawn point", sender: "carol", event: move("carol", 9, 9), ok: true,
+			setup: func(g *Game, clk *simClock) {
+				g.nameToPlayers["carol"] = &playerInfo{name: "carol", alive: true}
+				g.check(&UserJoinEvent{playerInfo: g.nameToPlayers["carol"]}, "carol")
+			},
+		},
+		{name: "move of a player joined before", sender: "dave", event: move("dave", 3, 3), ok: true},
+		{name: "move while dead", sender: "bob", event: move("bob", 2, 3)},
+		{name: "move of another player", sender: "mallory", event: move("alice", 5, 6)},
+		{name: "no sender", sender: "", event: move("alice", 5, 6)},
+		{name: "death of another player", sender: "mallory", event: &UserDeadEvent{playerInfo: &playerInfo{name: "alice"}, killer: "mallory"}},
+		{
+			name: "move without moves left", sender: "alice", event: move("alice", 5, 6),
+			setup: func(g *Game, clk *simClock) {
+				g.validation.moveTokens["alice"] = 0.5
+				g.validation.tokensTaken["alice"] = clk.Now()
+			},
+		},
+		{
+			name: "moves come back at the speed of the room", sender: "alice", event: move("alice", 5, 6), ok: true,
+			setup: func(g *Game, clk *simClock) {
+				g.roomSpeed = 4
+				g.validation.moveTokens["alice"] = 0
+				g.validation.tokensTaken["alice"] = clk.Now().Add(-300 * time.Millisecond)
+			},
+		},
+		{
+			name: "faster than the speed of the room", sender: "alice", event: move("alice", 5, 6),
+			setup: func(g *Game, clk *simClock) {
+				g.roomSpeed = 2
+				g.validation.moveTokens["alice"] = 0
+				g.validation.tokensTaken["alice"] = clk.Now().Add(-300 * time.Millisecond)
+			},
+		},
+		{name: "own bomb", sender: "alice", event: &SetBombEvent{bombName: "alice-abcde"}, ok: true},
+		{name: "bomb named after another player", sender: "mallory", event: &SetBombEvent{bombName: "alice-abcde"}},
+		{name: "random bomb", sender: "alice", event: &SetBombEvent{bombName: "random-abcde"}},
+		{name: "explode a bomb of another player", sender: "mallory", event: &ExplodeEvent{bombName: "alice-abcde"}},
+		{name: "push as another player", sender: "mallory", event: &BombMoveEvent{bombName: "alice-abcde", pusher: "alice"}},
+		{name: "revive at a spawn point", sender: "bob", event: revive("bob", 9, 9), ok: true},
+		{name: "revive away from the spawn points", sender: "bob", event: revive("bob", 4, 4)},
+		{name: "revive while alive", sender: "alice", event: revive("alice", 0, 0)},
+		{
+			name: "revive at a spawn point of the previous map", sender: "bob", event: revive("bob", 1, 1), ok: true,
+			setup: func(g *Game, clk *simClock) {
+				g.validation.previousMap = &GameMap{Width: 10, Height: 10, Spawns: []Position{{X: 1, Y: 1}}}
+			},
+		},
+		{
+			name: "revive where it died without a map", sender: "bob", event: revive("bob", 2, 2), ok: true,
+			setup: func(g *Game, clk *simClock) { g.gameMap = nil },
+		},
+		{
+			name: "revive elsewhere without a map", sender: "bob", event: revive("bob", 0, 0),
+			setup: func(g *Game, clk *simClock) { g.gameMap = nil },
+		},
+		{name: "map on the event topic", sender: "alice", event: &UpdateMapEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, clk := testCheckGame()
+			if tt.setup != nil {
+				tt.setup(g, clk)
+			}
+			if err := g.check(tt.event, tt.sender); (err == nil) != tt.ok {
+				t.Errorf("check = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheckMoveBurst(t *testing.T) {
+	g, clk := testCheckGame()
+	g.roomSpeed = 5
+	for i := 0; i < moveBurst; i++ {
+		if err := g.check(move("alice", 5, 6), "alice"); err != nil {
+			t.Fatalf("move %d: %v", i+1, err)
+		}
+	}
+	if err := g.check(move("alice", 5, 6), "alice"); err == nil {
+		t.Fatal("a move after the burst is accepted")
+	}
+	clk.advance(time.Second / 5)
+	if err := g.check(move("alice", 5, 6), "alice"); err != nil {
+		t.Fatal("a move at the speed of the room is dropped:", err)
+	}
+}